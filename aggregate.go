@@ -0,0 +1,323 @@
+package govship
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+)
+
+// FrameScore is the score of a single frame together with its index in the
+// sequence.
+type FrameScore struct {
+	Index int
+	Score float64
+	// Butteraugli holds every norm of a Butteraugli score, whose NormQ is
+	// Score, when ScoreFramesParallel is asked for them. It is nil
+	// otherwise.
+	Butteraugli *ButteraugliScore
+}
+
+// AggregatorOptions configures an Aggregator.
+type AggregatorOptions struct {
+	// HigherIsBetter tells the Aggregator which direction of the score is
+	// worse. Set it for SSIMU2 and CVVDP, leave it unset for Butteraugli.
+	HigherIsBetter bool
+	// WorstFrames is the number of worst frames to remember with their
+	// indices. Zero disables tracking.
+	WorstFrames int
+	// Streaming keeps memory constant regardless of the number of frames by
+	// summarizing scores in a quantile sketch instead of storing them.
+	// Percentiles and the median become approximations; every other
+	// statistic stays exact.
+	Streaming bool
+	// SketchSize trades memory for percentile accuracy in streaming mode.
+	// The rank error is roughly 1.7 / SketchSize. Defaults to 256.
+	SketchSize int
+}
+
+// AggregateSummary is a snapshot of the statistics of an Aggregator.
+type AggregateSummary struct {
+	Count                 int
+	Mean, HarmonicMean    float64
+	Median, StdDev        float64
+	Min, Max              float64
+	P1, P5, P95           float64
+	WorstFrames           []FrameScore
+	HigherIsBetter        bool
+	ApproximatePercentile bool
+}
+
+// Aggregator accumulates per-frame scores and summarizes them.
+//
+// Scores are added one at a time, in any order, and every statistic can be
+// queried at any point. In the default mode every score is kept so
+// percentiles are exact. With AggregatorOptions.Streaming memory use stays
+// constant, which suits multi-hour sequences.
+//
+// An Aggregator is not safe for concurrent use.
+type Aggregator struct {
+	opts AggregatorOptions
+
+	count    int
+	mean, m2 float64 // Welford running mean and sum of squared deviations
+	sumInv   float64
+	nonPos   int
+	min, max float64
+
+	values []float64 // exact mode
+	sorted bool
+	sketch *quantileSketch // streaming mode
+
+	worst worstHeap
+}
+
+// NewAggregator creates an empty Aggregator.
+func NewAggregator(opts AggregatorOptions) *Aggregator {
+	a := &Aggregator{opts: opts, min: math.Inf(1), max: math.Inf(-1)}
+	a.worst.higherIsBetter = opts.HigherIsBetter
+	if opts.Streaming {
+		size := opts.SketchSize
+		if size <= 0 {
+			size = 256
+		}
+		a.sketch = newQuantileSketch(size)
+	}
+	return a
+}
+
+// Add records the score of the next frame. The frame index is the number of
+// scores added before it.
+func (a *Aggregator) Add(score float64) { a.AddFrame(a.count, score) }
+
+// AddFrame records the score of the frame with the given index.
+func (a *Aggregator) AddFrame(index int, score float64) {
+	a.count++
+	delta := score - a.mean
+	a.mean += delta / float64(a.count)
+	a.m2 += delta * (score - a.mean)
+	if score > 0 {
+		a.sumInv += 1 / score
+	} else {
+		a.nonPos++
+	}
+	a.min, a.max = min(a.min, score), max(a.max, score)
+
+	if a.sketch != nil {
+		a.sketch.add(score)
+	} else {
+		a.values = append(a.values, score)
+		a.sorted = false
+	}
+
+	if a.opts.WorstFrames > 0 {
+		frame := FrameScore{Index: index, Score: score}
+		if a.worst.Len() < a.opts.WorstFrames {
+			heap.Push(&a.worst, frame)
+		} else if a.worst.worse(frame, a.worst.frames[0]) {
+			a.worst.frames[0] = frame
+			heap.Fix(&a.worst, 0)
+		}
+	}
+}
+
+// Count returns the number of scores added.
+func (a *Aggregator) Count() int { return a.count }
+
+// Mean returns the arithmetic mean of all scores.
+func (a *Aggregator) Mean() float64 { return a.mean }
+
+// HarmonicMean returns the harmonic mean of all scores. The harmonic mean is
+// only defined for positive values; NaN is returned if any score is zero or
+// negative.
+func (a *Aggregator) HarmonicMean() float64 {
+	if a.count == 0 || a.nonPos > 0 {
+		return math.NaN()
+	}
+	return float64(a.count) / a.sumInv
+}
+
+// StdDev returns the population standard deviation of all scores.
+func (a *Aggregator) StdDev() float64 {
+	if a.count == 0 {
+		return 0
+	}
+	return math.Sqrt(a.m2 / float64(a.count))
+}
+
+// Min returns the smallest score, or +Inf if no score was added.
+func (a *Aggregator) Min() float64 { return a.min }
+
+// Max returns the largest score, or -Inf if no score was added.
+func (a *Aggregator) Max() float64 { return a.max }
+
+// Median returns the 50th percentile of all scores.
+func (a *Aggregator) Median() float64 { return a.Percentile(50) }
+
+// Percentile returns the p-th percentile (0 to 100) of all scores. In
+// streaming mode the result is an approximation.
+func (a *Aggregator) Percentile(p float64) float64 {
+	if a.sketch != nil {
+		return a.sketch.quantile(p / 100)
+	}
+	if !a.sorted {
+		slices.Sort(a.values)
+		a.sorted = true
+	}
+	return sortedPercentile(a.values, p)
+}
+
+// MeanMinusStdDev returns mean - k*stddev, the conservative summary used by
+// av1an's target quality mode. For metrics where lower is better pass a
+// negative k to move the summary toward the worse frames.
+func (a *Aggregator) MeanMinusStdDev(k float64) float64 {
+	return a.Mean() - k*a.StdDev()
+}
+
+// WorstFrames returns the worst frames seen so far, worst first. At most
+// AggregatorOptions.WorstFrames frames are returned.
+func (a *Aggregator) WorstFrames() []FrameScore {
+	frames := slices.Clone(a.worst.frames)
+	slices.SortStableFunc(frames, func(x, y FrameScore) int {
+		switch {
+		case a.worst.worse(x, y):
+			return -1
+		case a.worst.worse(y, x):
+			return 1
+		}
+		return x.Index - y.Index
+	})
+	return frames
+}
+
+// Summary returns all statistics of the Aggregator in a single value.
+func (a *Aggregator) Summary() AggregateSummary {
+	return AggregateSummary{
+		Count:                 a.count,
+		Mean:                  a.Mean(),
+		HarmonicMean:          a.HarmonicMean(),
+		Median:                a.Median(),
+		StdDev:                a.StdDev(),
+		Min:                   a.Min(),
+		Max:                   a.Max(),
+		P1:                    a.Percentile(1),
+		P5:                    a.Percentile(5),
+		P95:                   a.Percentile(95),
+		WorstFrames:           a.WorstFrames(),
+		HigherIsBetter:        a.opts.HigherIsBetter,
+		ApproximatePercentile: a.sketch != nil,
+	}
+}
+
+// worstHeap keeps the N worst frames with the best of them at the root, so it
+// can be replaced when a worse frame arrives.
+type worstHeap struct {
+	frames         []FrameScore
+	higherIsBetter bool
+}
+
+// worse reports whether x has a worse score than y.
+func (h *worstHeap) worse(x, y FrameScore) bool {
+	if h.higherIsBetter {
+		return x.Score < y.Score
+	}
+	return x.Score > y.Score
+}
+
+func (h *worstHeap) Len() int { return len(h.frames) }
+
+func (h *worstHeap) Less(i, j int) bool {
+	return h.worse(h.frames[j], h.frames[i])
+}
+
+func (h *worstHeap) Swap(i, j int) {
+	h.frames[i], h.frames[j] = h.frames[j], h.frames[i]
+}
+
+func (h *worstHeap) Push(x any) { h.frames = append(h.frames, x.(FrameScore)) }
+
+func (h *worstHeap) Pop() any {
+	last := h.frames[len(h.frames)-1]
+	h.frames = h.frames[:len(h.frames)-1]
+	return last
+}
+
+// quantileSketch is a KLL quantile sketch. It keeps a hierarchy of buffers
+// where an item at level h stands for 2^h original values. When a buffer
+// fills up it is sorted and every other item is promoted to the next level,
+// which keeps the total size at about 3*k items.
+type quantileSketch struct {
+	k      int
+	levels [][]float64
+	offset int // alternates which half of a buffer is promoted
+}
+
+func newQuantileSketch(k int) *quantileSketch {
+	return &quantileSketch{k: k, levels: make([][]float64, 1)}
+}
+
+// capacity returns the buffer size of a level. Lower levels get
+// geometrically smaller buffers.
+func (s *quantileSketch) capacity(level int) int {
+	depth := len(s.levels) - 1 - level
+	return max(2, int(float64(s.k)*math.Pow(2.0/3.0, float64(depth))))
+}
+
+func (s *quantileSketch) add(v float64) {
+	s.levels[0] = append(s.levels[0], v)
+	for level := 0; level < len(s.levels); level++ {
+		if len(s.levels[level]) < s.capacity(level) {
+			continue
+		}
+		if level+1 == len(s.levels) {
+			s.levels = append(s.levels, nil)
+		}
+
+		buf := s.levels[level]
+		slices.Sort(buf)
+		// An odd item out stays at this level so no weight is lost.
+		keep := len(buf) % 2
+		for i := keep + s.offset; i < len(buf); i += 2 {
+			s.levels[level+1] = append(s.levels[level+1], buf[i])
+		}
+		s.offset ^= 1
+		s.levels[level] = buf[:keep]
+	}
+}
+
+// quantile returns an estimate of the q-th quantile (0 to 1).
+func (s *quantileSketch) quantile(q float64) float64 {
+	type item struct {
+		value  float64
+		weight uint64
+	}
+	var items []item
+	var total uint64
+	for level, buf := range s.levels {
+		for _, v := range buf {
+			items = append(items, item{v, 1 << level})
+			total += 1 << level
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	slices.SortFunc(items, func(a, b item) int {
+		switch {
+		case a.value < b.value:
+			return -1
+		case a.value > b.value:
+			return 1
+		}
+		return 0
+	})
+
+	target := min(max(q, 0), 1) * float64(total)
+	var cum uint64
+	for _, it := range items {
+		cum += it.weight
+		if float64(cum) >= target {
+			return it.value
+		}
+	}
+	return items[len(items)-1].value
+}
@@ -0,0 +1,82 @@
+package govship_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_Aggregator_Exact(t *testing.T) {
+	agg := vship.NewAggregator(vship.AggregatorOptions{
+		HigherIsBetter: true,
+		WorstFrames:    2,
+	})
+	for _, score := range []float64{80, 40, 90, 60, 70} {
+		agg.Add(score)
+	}
+
+	if agg.Count() != 5 || agg.Mean() != 68 {
+		t.Fatalf("Count/Mean = %d/%f, want 5/68", agg.Count(), agg.Mean())
+	}
+	if agg.Median() != 70 || agg.Min() != 40 || agg.Max() != 90 {
+		t.Fatalf("Median/Min/Max = %f/%f/%f", agg.Median(), agg.Min(),
+			agg.Max())
+	}
+
+	wantStd := math.Sqrt((144 + 784 + 484 + 64 + 4) / 5.0)
+	if math.Abs(agg.StdDev()-wantStd) > 1e-9 {
+		t.Fatalf("StdDev = %f, want %f", agg.StdDev(), wantStd)
+	}
+	if got := agg.MeanMinusStdDev(1); math.Abs(got-(68-wantStd)) > 1e-9 {
+		t.Fatalf("MeanMinusStdDev(1) = %f", got)
+	}
+
+	wantHarm := 5 / (1/80.0 + 1/40.0 + 1/90.0 + 1/60.0 + 1/70.0)
+	if math.Abs(agg.HarmonicMean()-wantHarm) > 1e-9 {
+		t.Fatalf("HarmonicMean = %f, want %f", agg.HarmonicMean(), wantHarm)
+	}
+
+	worst := agg.WorstFrames()
+	if len(worst) != 2 || worst[0] != (vship.FrameScore{Index: 1, Score: 40}) ||
+		worst[1] != (vship.FrameScore{Index: 3, Score: 60}) {
+		t.Fatalf("WorstFrames = %v", worst)
+	}
+
+	agg.Add(-1)
+	if !math.IsNaN(agg.HarmonicMean()) {
+		t.Fatal("HarmonicMean should be NaN with non-positive scores")
+	}
+}
+
+func Test_Aggregator_LowerIsBetter(t *testing.T) {
+	agg := vship.NewAggregator(vship.AggregatorOptions{WorstFrames: 1})
+	for i, score := range []float64{0.5, 3.2, 1.1} {
+		agg.AddFrame(i+10, score)
+	}
+	if worst := agg.WorstFrames(); worst[0].Index != 11 {
+		t.Fatalf("WorstFrames = %v, want frame 11", worst)
+	}
+}
+
+func Test_Aggregator_Streaming(t *testing.T) {
+	const n = 200000
+	agg := vship.NewAggregator(vship.AggregatorOptions{Streaming: true})
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range n {
+		agg.Add(rng.Float64() * 100)
+	}
+
+	if agg.Count() != n {
+		t.Fatalf("Count = %d, want %d", agg.Count(), n)
+	}
+	for _, p := range []float64{1, 5, 50, 95} {
+		if got := agg.Percentile(p); math.Abs(got-p) > 2 {
+			t.Fatalf("Percentile(%f) = %f, too far from %f", p, got, p)
+		}
+	}
+	if !agg.Summary().ApproximatePercentile {
+		t.Fatal("streaming summary should report approximate percentiles")
+	}
+}
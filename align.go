@@ -0,0 +1,360 @@
+package govship
+
+import (
+	"errors"
+	"io"
+	"math"
+	"slices"
+)
+
+// AlignOptions configures AlignFrames.
+type AlignOptions struct {
+	// MaxOffset is the largest global offset, in frames, searched between
+	// the two sequences in either direction. Defaults to 48.
+	MaxOffset int
+	// MaxDrift is how far, in frames, the matching may wander from the
+	// global offset through drops and duplicates. Defaults to 16.
+	MaxDrift int
+	// SignatureSize is the side of the square grid frames are reduced to
+	// before they are compared. Defaults to 8.
+	SignatureSize int
+	// GapPenalty is the cost of leaving a frame unmatched, in units of mean
+	// absolute luma difference between 0 and 1. Zero derives it from the
+	// typical difference between matching frames.
+	GapPenalty float64
+}
+
+// FrameMatch pairs a reference frame with the distorted frame showing the
+// same picture.
+type FrameMatch struct {
+	Ref, Dist int
+	// Distance is the mean absolute luma difference of the two frame
+	// signatures, between 0 and 1.
+	Distance float64
+}
+
+// Alignment describes how the frames of a distorted sequence correspond to
+// those of its reference.
+type Alignment struct {
+	// Offset is the global offset between the sequences: distorted frame
+	// i+Offset shows reference frame i at the start of the sequence.
+	Offset int
+	// Matches lists the matched frame pairs in order. Both indices increase
+	// strictly, so every frame is used at most once.
+	Matches []FrameMatch
+	// Dropped lists reference frames that are missing from the distorted
+	// sequence.
+	Dropped []int
+	// Duplicated lists distorted frames that repeat a neighbouring distorted
+	// frame and have no reference frame of their own.
+	Duplicated []int
+	// Extra lists any other unmatched distorted frames, such as leading or
+	// trailing frames outside the reference.
+	Extra []int
+}
+
+// Backtracking steps of the alignment.
+const (
+	alignMatch uint8 = iota
+	alignDrop        // reference frame without distorted frame
+	alignExtra       // distorted frame without reference frame
+)
+
+// AlignFrames finds the frame correspondence between a reference and a
+// distorted sequence.
+//
+// Every frame of both sources is reduced to a small luma signature. The
+// global offset is the shift that minimizes the signature difference over
+// the start of the sequences, and the per-frame matching is the cheapest
+// monotonic alignment around that offset, where skipping a frame on either
+// side costs a fixed gap penalty. This detects leading offsets as well as
+// frames dropped or duplicated by frame-rate conversion.
+//
+// Both sources are read to the end and rewound afterwards, so they are ready
+// to be passed to Alignment.Sources.
+func AlignFrames(ref, dist RewindableFrameSource, opts AlignOptions,
+) (*Alignment, error) {
+	if opts.MaxOffset <= 0 {
+		opts.MaxOffset = 48
+	}
+	if opts.MaxDrift <= 0 {
+		opts.MaxDrift = 16
+	}
+	if opts.SignatureSize <= 0 {
+		opts.SignatureSize = 8
+	}
+
+	refSigs, err := frameSignatures(ref, opts.SignatureSize)
+	if err != nil {
+		return nil, err
+	}
+	distSigs, err := frameSignatures(dist, opts.SignatureSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := rewind(ref, dist); err != nil {
+		return nil, err
+	}
+	if len(refSigs) == 0 || len(distSigs) == 0 {
+		return nil, errors.New("cannot align empty sequences")
+	}
+
+	offset, typical := globalOffset(refSigs, distSigs, opts.MaxOffset)
+	gap := opts.GapPenalty
+	if gap <= 0 {
+		gap = 2*typical + 1e-3
+	}
+
+	a := alignSignatures(refSigs, distSigs, offset, opts.MaxDrift, gap)
+	a.Offset = offset
+	return a, nil
+}
+
+// frameSignatures reads every frame of src and reduces it to a size x size
+// grid of mean luma values.
+func frameSignatures(src FrameSource, size int) ([][]float32, error) {
+	cs := src.Colorspace()
+	frame := NewFrame(&cs)
+	step := max(int(cs.Width)/(size*4), 1)
+
+	var sigs [][]float32
+	for {
+		if err := src.ReadFrame(frame); err != nil {
+			if isEOF(err) {
+				return sigs, nil
+			}
+			return nil, err
+		}
+		width, height, luma, err := readLuma(&cs, frame.Planes,
+			frame.LineSize, step)
+		if err != nil {
+			return nil, err
+		}
+
+		sig := make([]float32, size*size)
+		counts := make([]int, size*size)
+		for y := range height {
+			for x := range width {
+				cell := (y*size/height)*size + x*size/width
+				sig[cell] += luma[y*width+x]
+				counts[cell]++
+			}
+		}
+		for i := range sig {
+			sig[i] /= float32(max(counts[i], 1))
+		}
+		sigs = append(sigs, sig)
+	}
+}
+
+func signatureDistance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Abs(float64(a[i] - b[i]))
+	}
+	return sum / float64(len(a))
+}
+
+// globalOffset returns the offset with the lowest mean signature distance
+// over the first frames of the sequences, and the median distance of the
+// frames matched at that offset.
+func globalOffset(refSigs, distSigs [][]float32, maxOffset int) (int,
+	float64) {
+	const window = 1000
+	best, bestCost := 0, math.Inf(1)
+	for d := -maxOffset; d <= maxOffset; d++ {
+		var sum float64
+		var count int
+		for i := max(0, -d); i < min(len(refSigs), window); i++ {
+			if i+d >= len(distSigs) {
+				break
+			}
+			sum += signatureDistance(refSigs[i], distSigs[i+d])
+			count++
+		}
+		if count > 0 && sum/float64(count) < bestCost {
+			best, bestCost = d, sum/float64(count)
+		}
+	}
+
+	var distances []float64
+	for i := max(0, -best); i < min(len(refSigs), window); i++ {
+		if i+best >= len(distSigs) {
+			break
+		}
+		distances = append(distances, signatureDistance(refSigs[i],
+			distSigs[i+best]))
+	}
+	slices.Sort(distances)
+	return best, sortedPercentile(distances, 50)
+}
+
+// alignSignatures computes the cheapest monotonic alignment of two signature
+// sequences in a band of half-width drift around the diagonal j = i + offset.
+// Cell (i, j) of the dynamic program is the cost of aligning the first i
+// reference and the first j distorted frames.
+func alignSignatures(refSigs, distSigs [][]float32, offset, drift int,
+	gap float64) *Alignment {
+	n, m := len(refSigs), len(distSigs)
+	width := 2*drift + 1
+	// band maps (i, j) to its column in the band, or -1 outside it.
+	band := func(i, j int) int {
+		b := j - i - offset + drift
+		if j < 0 || j > m || b < 0 || b >= width {
+			return -1
+		}
+		return b
+	}
+
+	// Only two rows of costs are kept; the steps are needed for
+	// backtracking.
+	prev, cur := make([]float64, width), make([]float64, width)
+	step := make([][]uint8, n+1)
+	endI, endJ, endCost := -1, -1, math.Inf(1)
+
+	for i := 0; i <= n; i++ {
+		step[i] = make([]uint8, width)
+		for b := range width {
+			cur[b] = math.Inf(1)
+			j := i + offset - drift + b
+			if j < 0 || j > m {
+				continue
+			}
+
+			switch {
+			case i == 0 || j == 0:
+				// Unmatched leading frames are plain gaps.
+				cur[b] = float64(i+j) * gap
+			default:
+				if p := band(i-1, j-1); p >= 0 {
+					cur[b] = prev[p] + signatureDistance(refSigs[i-1],
+						distSigs[j-1])
+					step[i][b] = alignMatch
+				}
+				if p := band(i-1, j); p >= 0 && prev[p]+gap < cur[b] {
+					cur[b], step[i][b] = prev[p]+gap, alignDrop
+				}
+				if p := band(i, j-1); p >= 0 && cur[p]+gap < cur[b] {
+					cur[b], step[i][b] = cur[p]+gap, alignExtra
+				}
+			}
+
+			// End on the last row or column, charging the frames left
+			// over.
+			if i == n || j == m {
+				if c := cur[b] + float64(n-i+m-j)*gap; c < endCost {
+					endI, endJ, endCost = i, j, c
+				}
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	a := &Alignment{}
+	// Which copy of a repeated frame gets matched is arbitrary, so an
+	// unmatched frame counts as a duplicate of either neighbour.
+	unmatchedDist := func(j int) {
+		same := func(k int) bool {
+			return k >= 0 && k < m &&
+				signatureDistance(distSigs[j], distSigs[k]) <= gap/2
+		}
+		if same(j-1) || same(j+1) {
+			a.Duplicated = append(a.Duplicated, j)
+		} else {
+			a.Extra = append(a.Extra, j)
+		}
+	}
+	for i := n - 1; i >= endI; i-- {
+		a.Dropped = append(a.Dropped, i)
+	}
+	for j := m - 1; j >= endJ; j-- {
+		unmatchedDist(j)
+	}
+
+	i, j := endI, endJ
+	for i > 0 || j > 0 {
+		if i == 0 || j == 0 {
+			// Leading gaps are not stored step by step.
+			for ; i > 0; i-- {
+				a.Dropped = append(a.Dropped, i-1)
+			}
+			for ; j > 0; j-- {
+				unmatchedDist(j - 1)
+			}
+			break
+		}
+		switch step[i][band(i, j)] {
+		case alignMatch:
+			a.Matches = append(a.Matches, FrameMatch{i - 1, j - 1,
+				signatureDistance(refSigs[i-1], distSigs[j-1])})
+			i, j = i-1, j-1
+		case alignDrop:
+			a.Dropped = append(a.Dropped, i-1)
+			i--
+		case alignExtra:
+			unmatchedDist(j - 1)
+			j--
+		}
+	}
+
+	slices.Reverse(a.Matches)
+	slices.Sort(a.Dropped)
+	slices.Sort(a.Duplicated)
+	slices.Sort(a.Extra)
+	return a
+}
+
+// Sources returns FrameSources that only yield the matched frames of ref and
+// dist, so that the i-th frames of both form the i-th entry of Matches.
+//
+// The returned sources can be passed to any helper taking a reference and a
+// distorted FrameSource, or read frame by frame to feed a handler directly.
+// ref and dist must be positioned at their first frame, as they are after
+// AlignFrames. The returned sources can be rewound if ref and dist can.
+func (a *Alignment) Sources(ref, dist FrameSource) (RewindableFrameSource,
+	RewindableFrameSource) {
+	refIdx := make([]int, len(a.Matches))
+	distIdx := make([]int, len(a.Matches))
+	for i, m := range a.Matches {
+		refIdx[i], distIdx[i] = m.Ref, m.Dist
+	}
+	return &alignedSource{src: ref, indices: refIdx},
+		&alignedSource{src: dist, indices: distIdx}
+}
+
+// alignedSource yields the frames of src at the given increasing indices.
+type alignedSource struct {
+	src     FrameSource
+	indices []int
+	next    int // index into indices
+	pos     int // frames read from src so far
+}
+
+func (s *alignedSource) Colorspace() Colorspace { return s.src.Colorspace() }
+
+func (s *alignedSource) ReadFrame(frame *Frame) error {
+	if s.next >= len(s.indices) {
+		return io.EOF
+	}
+	target := s.indices[s.next]
+	for s.pos <= target {
+		if err := s.src.ReadFrame(frame); err != nil {
+			return err
+		}
+		s.pos++
+	}
+	s.next++
+	return nil
+}
+
+func (s *alignedSource) Rewind() error {
+	r, ok := s.src.(RewindableFrameSource)
+	if !ok {
+		return errors.New("underlying frame source cannot be rewound")
+	}
+	if err := r.Rewind(); err != nil {
+		return err
+	}
+	s.next, s.pos = 0, 0
+	return nil
+}
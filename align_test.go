@@ -0,0 +1,70 @@
+package govship_test
+
+import (
+	"slices"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_AlignFrames(t *testing.T) {
+	var refLevels []byte
+	for i := range 20 {
+		refLevels = append(refLevels, byte(20+i*10))
+	}
+
+	// Two leading extra frames, reference frame 5 dropped and the frame
+	// after it shown twice.
+	distLevels := []byte{1, 250}
+	distLevels = append(distLevels, refLevels[:5]...)
+	distLevels = append(distLevels, refLevels[6], refLevels[6])
+	distLevels = append(distLevels, refLevels[7:]...)
+
+	ref := grayFrames(64, 32, refLevels...)
+	dist := grayFrames(64, 32, distLevels...)
+
+	alignment, err := vship.AlignFrames(ref, dist, vship.AlignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alignment.Offset != 2 {
+		t.Fatalf("Offset = %d, want 2", alignment.Offset)
+	}
+	if !slices.Equal(alignment.Dropped, []int{5}) {
+		t.Fatalf("Dropped = %v, want [5]", alignment.Dropped)
+	}
+	dup := alignment.Duplicated
+	if !slices.Equal(dup, []int{7}) && !slices.Equal(dup, []int{8}) {
+		t.Fatalf("Duplicated = %v, want [7] or [8]", dup)
+	}
+	if !slices.Equal(alignment.Extra, []int{0, 1}) {
+		t.Fatalf("Extra = %v, want [0 1]", alignment.Extra)
+	}
+	if len(alignment.Matches) != 19 {
+		t.Fatalf("got %d matches, want 19", len(alignment.Matches))
+	}
+	for _, m := range alignment.Matches {
+		if m.Distance > 1e-6 {
+			t.Fatalf("frames %d and %d matched with distance %f", m.Ref,
+				m.Dist, m.Distance)
+		}
+	}
+
+	// The aligned sources yield identical frames pair by pair.
+	alignedRef, alignedDist := alignment.Sources(ref, dist)
+	cs := ref.Colorspace()
+	refFrame, distFrame := vship.NewFrame(&cs), vship.NewFrame(&cs)
+	for i := range alignment.Matches {
+		if err := alignedRef.ReadFrame(refFrame); err != nil {
+			t.Fatal(err)
+		}
+		if err := alignedDist.ReadFrame(distFrame); err != nil {
+			t.Fatal(err)
+		}
+		if refFrame.Planes[0][0] != distFrame.Planes[0][0] {
+			t.Fatalf("pair %d differs: %d != %d", i, refFrame.Planes[0][0],
+				distFrame.Planes[0][0])
+		}
+	}
+}
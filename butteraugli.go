@@ -20,6 +20,10 @@ import "unsafe"
 type ButteraugliHandler struct {
 	ptr  *C.Vship_ButteraugliHandler
 	init bool
+	// Size of the distortion map produced by ComputeScoreWithMap.
+	mapWidth, mapHeight int
+	// Norm used for ButteraugliScore.NormQ.
+	qnorm int
 }
 
 // ButteraugliScore contains the results of a Butteraugli comparison.
@@ -49,7 +53,8 @@ type ButteraugliScore struct {
 //
 // Qnorm controls how aggressively differences are weighted perceptually.
 // DisplayBrightnessInNits defines the assumed peak brightness of the display
-// used when interpreting visual differences.
+// used when interpreting visual differences; ButteraugliIntensityTarget
+// derives it from the transfer function.
 //
 // The returned handler can be reused for multiple comparisons and should be
 // closed when no longer needed.
@@ -66,9 +71,58 @@ func NewButteraugliHandler(src, dst *Colorspace, Qnorm int,
 
 	handler.ptr = &h
 	handler.init = true
+	handler.mapWidth, handler.mapHeight = src.outputSize()
+	handler.qnorm = Qnorm
 	return &handler, code
 }
 
+// Luminances in cd/m² used to derive Butteraugli intensity targets.
+const (
+	// pqPeakLuminance is the luminance of the largest PQ code value.
+	pqPeakLuminance = 10000
+	// hlgNominalPeak is the BT.2100 reference HLG display peak.
+	hlgNominalPeak = 1000
+	// sdrReferenceWhite is the BT.2408 reference white, also the graphics
+	// white of SDR content shown on HDR displays.
+	sdrReferenceWhite = 203
+)
+
+// ButteraugliIntensityTarget returns the luminance in cd/m² of full-scale
+// signal in the transfer function of cs, the DisplayBrightnessInNits to pass
+// to NewButteraugliHandler. display is optional.
+//
+//   - PQ is absolute: full scale is 10000 cd/m² on any display.
+//   - HLG is relative: the HLG OOTF maps full scale to the display peak,
+//     whatever the BT.2100 system gamma. The peak is that of display, or
+//     the nominal 1000 cd/m².
+//   - Every other transfer is SDR with full scale shown as white: the peak
+//     of display, or the 203 cd/m² reference white of BT.2408.
+func ButteraugliIntensityTarget(cs *Colorspace,
+	display *DisplayModel) float32 {
+	switch cs.ColorTransfer {
+	case ColorTransferTRCPQ:
+		return pqPeakLuminance
+	case ColorTransferTRCHLG:
+		if display != nil && display.DisplayMaxLuminance > 0 {
+			return display.DisplayMaxLuminance
+		}
+		return hlgNominalPeak
+	}
+	if display != nil && display.DisplayMaxLuminance > 0 {
+		return display.DisplayMaxLuminance
+	}
+	return sdrReferenceWhite
+}
+
+// NewButteraugliHandlerForDisplay creates a Butteraugli evaluator whose
+// display brightness is derived from the transfer function of src and the
+// optional display model with ButteraugliIntensityTarget.
+func NewButteraugliHandlerForDisplay(src, dst *Colorspace, Qnorm int,
+	display *DisplayModel) (*ButteraugliHandler, ExceptionCode) {
+	return NewButteraugliHandler(src, dst, Qnorm,
+		ButteraugliIntensityTarget(src, display))
+}
+
 // ComputeScore compares a reference image against a distorted image and
 // produces Butteraugli quality metrics.
 //
@@ -120,6 +174,50 @@ func (handler *ButteraugliHandler) ComputeScore(
 	return ExceptionCode(code)
 }
 
+// ComputeScoreWithMap compares a reference image against a distorted image
+// like ComputeScore and additionally returns the per-pixel distortion map.
+//
+// The map has the size of the reference image after cropping and resizing,
+// see MapSize. A new map is allocated for every call.
+func (handler *ButteraugliHandler) ComputeScoreWithMap(src1, src2 [3][]byte,
+	srcLineSize1, srcLineSize2 [3]int64) (ButteraugliScore, *DistortionMap,
+	ExceptionCode) {
+	var score ButteraugliScore
+	dmap := NewDistortionMap(handler.MapSize())
+
+	code := handler.ComputeScore(&score, dmap.bytes(), dmap.stride(), src1,
+		src2, srcLineSize1, srcLineSize2)
+	if !code.IsNone() {
+		return ButteraugliScore{}, nil, code
+	}
+	return score, dmap, code
+}
+
+// ScoreFrame computes the Butteraugli score of a pair of frames and returns
+// its NormQ, the norm chosen when the handler was created. It implements
+// FrameScorer.
+func (handler *ButteraugliHandler) ScoreFrame(ref, dist *Frame) (float64,
+	ExceptionCode) {
+	score, code := handler.ScoreButteraugliFrame(ref, dist)
+	return score.NormQ, code
+}
+
+// ScoreButteraugliFrame computes the Butteraugli score of a pair of frames.
+// It implements ButteraugliFrameScorer.
+func (handler *ButteraugliHandler) ScoreButteraugliFrame(ref, dist *Frame) (
+	ButteraugliScore, ExceptionCode) {
+	var score ButteraugliScore
+	code := handler.ComputeScore(&score, nil, 0, ref.Planes, dist.Planes,
+		ref.LineSize, dist.LineSize)
+	return score, code
+}
+
+// MapSize returns the width and height of the distortion maps produced by
+// this handler.
+func (handler *ButteraugliHandler) MapSize() (width, height int) {
+	return handler.mapWidth, handler.mapHeight
+}
+
 // Close releases the resources associated with the handler.
 //
 // After Close is called, the handler must not be used again. Calling Close
@@ -61,3 +61,29 @@ func Test_ButteraugliHandler_ComputeScore(t *testing.T) {
 	t.Logf("Butteraugli Score: NormQ=%.4f Norm3=%.4f NormInf=%.4f",
 		score.NormQ, score.Norm3, score.NormInf)
 }
+
+func Test_ButteraugliIntensityTarget(t *testing.T) {
+	var cs vship.Colorspace
+	cs.SetDefaults(64, 64, vship.SamplingFormatUInt10)
+	tv := vship.DisplayModelPresetTV65
+
+	for _, tc := range []struct {
+		transfer vship.ColorTransfer
+		display  *vship.DisplayModel
+		want     float32
+	}{
+		{vship.ColorTransferTRCBT709, nil, 203},
+		{vship.ColorTransferTRCSRGB, &tv, 350},
+		{vship.ColorTransferTRCPQ, nil, 10000},
+		{vship.ColorTransferTRCPQ, &tv, 10000},
+		{vship.ColorTransferTRCHLG, nil, 1000},
+		{vship.ColorTransferTRCHLG, &tv, 350},
+	} {
+		cs.ColorTransfer = tc.transfer
+		if got := vship.ButteraugliIntensityTarget(&cs,
+			tc.display); got != tc.want {
+			t.Fatalf("transfer %v with display %v: %v, want %v",
+				tc.transfer, tc.display != nil, got, tc.want)
+		}
+	}
+}
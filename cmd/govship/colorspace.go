@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+	"github.com/GreatValueCreamSoda/govship/report"
+)
+
+// Names accepted by the colorspace override flags, those written in reports.
+var (
+	matrices        = byName(report.MatrixNames)
+	transfers       = byName(report.TransferNames)
+	primaries       = byName(report.PrimariesNames)
+	ranges          = byName(report.ColorRangeNames)
+	chromaLocations = byName(report.ChromaLocationNames)
+)
+
+func init() {
+	// Internal primaries are only reported, they cannot be requested.
+	delete(primaries, report.PrimariesNames[vship.ColorPrimariesINTERNAL])
+}
+
+// byName inverts a table of enumeration names.
+func byName[T comparable](names map[T]string) map[string]T {
+	values := make(map[string]T, len(names))
+	for v, name := range names {
+		values[name] = v
+	}
+	return values
+}
+
+// names lists the keys of a flag value map, sorted and comma separated.
+func names[T any](values map[string]T) string {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return strings.Join(keys, ", ")
+}
+
+// lookup sets *dst to the value named by name, unless name is empty.
+func lookup[T any](dst *T, flagName, name string,
+	values map[string]T) error {
+	if name == "" {
+		return nil
+	}
+	v, ok := values[strings.ToLower(name)]
+	if !ok {
+		return usageError{fmt.Sprintf("invalid -%s %q, want one of %s",
+			flagName, name, names(values))}
+	}
+	*dst = v
+	return nil
+}
+
+// applyOverrides replaces the colorspace properties given on the command
+// line.
+func applyOverrides(cs *vship.Colorspace, opts *scoreOptions) error {
+	for _, err := range []error{
+		lookup(&cs.ColorMatrix, "matrix", opts.matrix, matrices),
+		lookup(&cs.ColorTransfer, "transfer", opts.transfer, transfers),
+		lookup(&cs.ColorPrimaries, "primaries", opts.primaries, primaries),
+		lookup(&cs.ColorRange, "range", opts.colorRange, ranges),
+		lookup(&cs.ChromaLocation, "chroma-location", opts.chromaLocation,
+			chromaLocations),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
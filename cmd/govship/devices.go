@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// inventory is the output of the devices command.
+type inventory struct {
+	Version string   `json:"version"`
+	Backend string   `json:"backend"`
+	Devices []device `json:"devices"`
+	Usable  int      `json:"usable"`
+	// Error explains why no device could be listed.
+	Error string `json:"error,omitempty"`
+}
+
+// device describes one GPU and the result of its health check.
+type device struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	VRAMBytes       uint64 `json:"vram_bytes"`
+	Integrated      bool   `json:"integrated"`
+	Multiprocessors int    `json:"multiprocessors"`
+	WarpSize        int    `json:"warp_size"`
+	Healthy         bool   `json:"healthy"`
+	Error           string `json:"error,omitempty"`
+}
+
+// errNoDevice is returned when no device passes the health check.
+var errNoDevice = errors.New("no usable GPU device found")
+
+func runDevices(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("devices", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: govship devices [flags]")
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print the inventory as JSON")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() != 0 {
+		return usageError{"devices takes no arguments"}
+	}
+
+	inv := listDevices()
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(inv); err != nil {
+			return err
+		}
+	} else {
+		printDevices(stdout, inv)
+	}
+	if inv.Usable == 0 {
+		return errNoDevice
+	}
+	return nil
+}
+
+// listDevices queries every device and runs its health check.
+func listDevices() inventory {
+	v := vship.GetVersion()
+	inv := inventory{
+		Version: fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.MinorMinor),
+		Backend: v.Backend.String(),
+		Devices: []device{},
+	}
+
+	count, code := vship.GetDeviceCount()
+	if !code.IsNone() {
+		inv.Error = code.GetError().Error()
+		return inv
+	}
+	for id := range count {
+		d := device{ID: id}
+		info, code := vship.GetDeviceInfo(id)
+		if code.IsNone() {
+			d.Name, d.VRAMBytes = info.Name, info.VRAMSize
+			d.Integrated = info.Integrated
+			d.Multiprocessors = info.MultiProcessorCount
+			d.WarpSize = info.WarpSize
+			code = vship.FullGpuCheck(id)
+		}
+		if code.IsNone() {
+			d.Healthy = true
+			inv.Usable++
+		} else {
+			d.Error = code.GetError().Error()
+		}
+		inv.Devices = append(inv.Devices, d)
+	}
+	return inv
+}
+
+func printDevices(w io.Writer, inv inventory) {
+	fmt.Fprintf(w, "Vship %s (%s)\n", inv.Version, inv.Backend)
+	if inv.Error != "" {
+		fmt.Fprintf(w, "no devices: %s\n", inv.Error)
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tVRAM\tINTEGRATED\tSMS\tWARP\tSTATUS")
+	for _, d := range inv.Devices {
+		status := "ok"
+		if !d.Healthy {
+			status = d.Error
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%.1f GiB\t%t\t%d\t%d\t%s\n", d.ID, d.Name,
+			float64(d.VRAMBytes)/(1<<30), d.Integrated, d.Multiprocessors,
+			d.WarpSize, status)
+	}
+	tw.Flush()
+}
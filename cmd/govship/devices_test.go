@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func Test_RunDevices_JSON(t *testing.T) {
+	var out bytes.Buffer
+	err := runDevices([]string{"-json"}, &out)
+
+	var inv inventory
+	if jsonErr := json.Unmarshal(out.Bytes(), &inv); jsonErr != nil {
+		t.Fatalf("output is not JSON: %v\n%s", jsonErr, out.String())
+	}
+	if inv.Version == "" || inv.Backend == "" || inv.Devices == nil {
+		t.Fatalf("incomplete inventory %+v", inv)
+	}
+
+	// The probe fails exactly when no device is usable.
+	if (inv.Usable == 0) != (err == errNoDevice) {
+		t.Fatalf("usable = %d but err = %v", inv.Usable, err)
+	}
+	if inv.Usable == 0 && err == nil {
+		t.Fatal("expected an error without usable devices")
+	}
+}
+
+func Test_RunDevices_Arguments(t *testing.T) {
+	if err := runDevices([]string{"extra"}, &bytes.Buffer{}); exitCode(err) !=
+		2 {
+		t.Fatalf("err = %v, want a usage error", err)
+	}
+}
@@ -0,0 +1,75 @@
+// Command govship scores video with the perceptual metrics of Vship.
+//
+// Usage:
+//
+//	govship score [flags] reference.y4m distorted.y4m
+//	govship devices [-json]
+//
+// Run a subcommand with -h for its flags. Flags must come before the file
+// arguments. The devices command exits with status 1 when no GPU passes its
+// health check, so it can serve as a readiness probe.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a govship subcommand.
+type command struct {
+	name, summary string
+	run           func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"score", "score a distorted video against its reference", runScore},
+	{"devices", "list GPUs and check that they are usable", runDevices},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: govship <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		return
+	}
+
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "govship:", err)
+			os.Exit(exitCode(err))
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "govship: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+// usageError marks errors caused by invalid command-line arguments.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func exitCode(err error) int {
+	if _, ok := err.(usageError); ok {
+		return 2
+	}
+	return 1
+}
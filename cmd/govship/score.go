@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+	"github.com/GreatValueCreamSoda/govship/report"
+)
+
+// scoreOptions holds the flags of the score command.
+type scoreOptions struct {
+	metric          string
+	matrix          string
+	transfer        string
+	primaries       string
+	colorRange      string
+	chromaLocation  string
+	displayModel    string
+	displayConfig   string
+	resizeToDisplay bool
+	registerInputs  bool
+	qnorm           int
+	nits            float64
+	fps             float64
+	start, end      int
+	threads         int
+	device          int
+	perFrame        bool
+	worst           int
+	report          string
+}
+
+func (o *scoreOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.metric, "metric", "ssimu2",
+		"metric: ssimu2, butteraugli or cvvdp")
+	fs.StringVar(&o.matrix, "matrix", "",
+		"override the YUV matrix: "+names(matrices))
+	fs.StringVar(&o.transfer, "transfer", "",
+		"override the transfer function: "+names(transfers))
+	fs.StringVar(&o.primaries, "primaries", "",
+		"override the primaries: "+names(primaries))
+	fs.StringVar(&o.colorRange, "range", "",
+		"override the color range: "+names(ranges))
+	fs.StringVar(&o.chromaLocation, "chroma-location", "",
+		"override the chroma location: "+names(chromaLocations))
+	fs.StringVar(&o.displayModel, "display-model", "standard_fhd",
+		"CVVDP display model key")
+	fs.StringVar(&o.displayConfig, "display-config", "",
+		"CVVDP display model JSON file defining -display-model")
+	fs.BoolVar(&o.resizeToDisplay, "resize-to-display", false,
+		"CVVDP: resize frames to the display resolution")
+	fs.BoolVar(&o.registerInputs, "register", false, "crop and rescale "+
+		"both videos to their common area when the distorted one is "+
+		"shifted or rescaled")
+	fs.IntVar(&o.qnorm, "qnorm", 2, "Butteraugli norm reported per frame")
+	fs.Float64Var(&o.nits, "nits", 0, "Butteraugli display peak "+
+		"brightness in cd/m², 0 to derive it from the transfer function")
+	fs.Float64Var(&o.fps, "fps", 0,
+		"CVVDP frame rate, 0 to use the rate of the reference")
+	fs.IntVar(&o.start, "start", 0, "first frame to score")
+	fs.IntVar(&o.end, "end", 0,
+		"frame after the last frame to score, 0 for the end of the video")
+	fs.IntVar(&o.threads, "threads", 1,
+		"SSIMU2 and Butteraugli handlers scoring frames in parallel")
+	fs.IntVar(&o.device, "device", 0, "GPU to run on")
+	fs.BoolVar(&o.perFrame, "per-frame", true, "print the score of every "+
+		"frame")
+	fs.IntVar(&o.worst, "worst", 5, "number of worst frames to list")
+	fs.StringVar(&o.report, "report", "", "write a report of the scores "+
+		"to a file as JSON, or as CSV if its name ends in .csv, with the "+
+		"aggregates in <name>_aggregate.csv and the whole report in "+
+		"<name>.json")
+}
+
+func runScore(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: govship score [flags] "+
+			"reference.y4m distorted.y4m")
+		fs.PrintDefaults()
+	}
+	var opts scoreOptions
+	opts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return usageError{err.Error()}
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return usageError{"score needs a reference and a distorted file"}
+	}
+	if opts.start < 0 || (opts.end != 0 && opts.end <= opts.start) {
+		return usageError{"invalid frame range"}
+	}
+
+	ref, closeRef, err := openY4M(fs.Arg(0), &opts)
+	if err != nil {
+		return err
+	}
+	defer closeRef()
+	dist, closeDist, err := openY4M(fs.Arg(1), &opts)
+	if err != nil {
+		return err
+	}
+	defer closeDist()
+
+	spec := vship.HandlerSpec{Source: ref.Colorspace(),
+		Distorted: dist.Colorspace(), Device: opts.device,
+		Qnorm: opts.qnorm, DisplayBrightness: float32(opts.nits),
+		FPS: float32(opts.fps), ResizeToDisplay: opts.resizeToDisplay,
+		ModelKey: opts.displayModel}
+	if spec.FPS <= 0 {
+		spec.FPS = ref.FPS()
+	}
+	var displayModel *vship.DisplayModel
+	if opts.displayConfig != "" {
+		config, err := os.ReadFile(opts.displayConfig)
+		if err != nil {
+			return err
+		}
+		spec.ConfigJSON = string(config)
+		models, err := vship.ParseCVVDPDisplayModels(config)
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.displayConfig, err)
+		}
+		if m, ok := models.Models[opts.displayModel]; ok {
+			displayModel = &m
+		}
+	}
+
+	refRange := &rangeSource{src: ref, start: opts.start, end: opts.end}
+	distRange := &rangeSource{src: dist, start: opts.start, end: opts.end}
+	var refSrc, distSrc vship.FrameSource = refRange, distRange
+	if opts.registerInputs {
+		refSrc, distSrc, _, err = spec.Register(refRange, distRange,
+			vship.RegistrationOptions{})
+		if err != nil {
+			return fmt.Errorf("registering the videos: %w", err)
+		}
+	}
+	out := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	defer out.Flush()
+
+	switch strings.ToLower(opts.metric) {
+	case "ssimu2":
+		spec.Metric = vship.MetricSSIMU2
+	case "butteraugli":
+		spec.Metric = vship.MetricButteraugli
+	case "cvvdp":
+		spec.Metric = vship.MetricCVVDP
+	default:
+		return usageError{fmt.Sprintf("unknown metric %q", opts.metric)}
+	}
+
+	rep := report.New(spec)
+	if spec.Metric == vship.MetricCVVDP && displayModel != nil {
+		rep.SetDisplayModel(*displayModel)
+	}
+	if spec.Metric == vship.MetricCVVDP {
+		err = scoreCVVDP(spec, refSrc, distSrc, &opts, out, rep)
+	} else {
+		err = scoreFrames(spec, refSrc, distSrc, &opts, out, rep)
+	}
+	if err != nil || opts.report == "" {
+		return err
+	}
+	return writeReport(opts.report, rep)
+}
+
+// reportFile is one file written by writeReport.
+type reportFile struct {
+	path  string
+	write func(io.Writer) error
+}
+
+// writeReport writes rep to path as JSON. If the name ends in .csv the
+// frames are written there as CSV instead, next to the aggregates in
+// <name>_aggregate.csv and the whole report in <name>.json. Every file is
+// encoded before any is created, so a failure leaves no partial report.
+func writeReport(path string, rep *report.Report) error {
+	files := []reportFile{{path, rep.WriteJSON}}
+	if ext := filepath.Ext(path); strings.EqualFold(ext, ".csv") {
+		base := strings.TrimSuffix(path, ext)
+		files = []reportFile{{path, rep.WriteCSV},
+			{base + "_aggregate" + ext, rep.WriteAggregateCSV},
+			{base + ".json", rep.WriteJSON}}
+	}
+
+	data := make([]bytes.Buffer, len(files))
+	for i, f := range files {
+		if err := f.write(&data[i]); err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+	for i, f := range files {
+		if err := os.WriteFile(f.path, data[i].Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scoreFrames scores every frame independently with SSIMU2 or Butteraugli
+// on opts.threads handlers, prints the aggregate and records it in rep.
+func scoreFrames(spec vship.HandlerSpec, ref, dist vship.FrameSource,
+	opts *scoreOptions, out *tabwriter.Writer, rep *report.Report) error {
+	pool := vship.NewHandlerPool(vship.HandlerPoolOptions{})
+	defer pool.Close()
+
+	scorers := make([]vship.FrameScorer, max(opts.threads, 1))
+	for i := range scorers {
+		scorer := vship.NewResilientScorer(pool, spec,
+			vship.RecoveryOptions{})
+		defer scorer.Close()
+		scorers[i] = scorer
+	}
+
+	agg := vship.NewAggregator(vship.AggregatorOptions{
+		HigherIsBetter: spec.Metric == vship.MetricSSIMU2,
+		WorstFrames:    opts.worst})
+	if opts.perFrame {
+		fmt.Fprintf(out, "frame\t%v\n", spec.Metric)
+	}
+	err := vship.ScoreFramesParallel(scorers, ref, dist,
+		vship.ParallelOptions{
+			ButteraugliNorms: spec.Metric == vship.MetricButteraugli,
+		}, func(f vship.FrameScore) error {
+			index := f.Index + opts.start
+			agg.AddFrame(index, f.Score)
+			if f.Butteraugli != nil {
+				rep.AddButteraugliFrame(index, *f.Butteraugli)
+			} else {
+				rep.AddFrame(index, f.Score)
+			}
+			if opts.perFrame {
+				fmt.Fprintf(out, "%d\t%.6f\n", index, f.Score)
+			}
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	if agg.Count() == 0 {
+		return errors.New("no frames to score")
+	}
+
+	s := agg.Summary()
+	rep.SetAggregate(s)
+	if opts.perFrame {
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "frames\t%d\n", s.Count)
+	for _, stat := range []struct {
+		name  string
+		value float64
+	}{{"mean", s.Mean}, {"harmonic mean", s.HarmonicMean},
+		{"median", s.Median}, {"stddev", s.StdDev}, {"min", s.Min},
+		{"max", s.Max}, {"p1", s.P1}, {"p5", s.P5}, {"p95", s.P95}} {
+		fmt.Fprintf(out, "%s\t%.6f\n", stat.name, stat.value)
+	}
+	for _, f := range s.WorstFrames {
+		fmt.Fprintf(out, "worst frame\t%d\t%.6f\n", f.Index, f.Score)
+	}
+	return nil
+}
+
+// scoreCVVDP scores the sequence with a single CVVDP handler and prints the
+// JOD accumulated after every frame, recording it in rep.
+func scoreCVVDP(spec vship.HandlerSpec, ref, dist vship.FrameSource,
+	opts *scoreOptions, out *tabwriter.Writer, rep *report.Report) error {
+	// Vship selects the device per thread, so creation and scoring must
+	// happen on the same one.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if code := vship.SetDevice(spec.Device); !code.IsNone() {
+		return code.Err()
+	}
+
+	h, code := spec.NewHandler()
+	if !code.IsNone() {
+		return code.Err()
+	}
+	handler := h.(*vship.CVVDPHandler)
+	defer handler.Close()
+
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	refFrame, distFrame := vship.NewFrame(&refCS), vship.NewFrame(&distCS)
+	if opts.perFrame {
+		fmt.Fprintln(out, "frame\tJOD")
+	}
+	var jod float64
+	count := 0
+	for ; ; count++ {
+		refErr := ref.ReadFrame(refFrame)
+		distErr := dist.ReadFrame(distFrame)
+		if refErr == io.EOF && distErr == io.EOF {
+			break
+		}
+		if err := errors.Join(refErr, distErr); err != nil {
+			if refErr == io.EOF || distErr == io.EOF {
+				return fmt.Errorf("videos differ in length after %d "+
+					"frames", count)
+			}
+			return err
+		}
+
+		jod, code = handler.ComputeScore(nil, 0, refFrame.Planes,
+			distFrame.Planes, refFrame.LineSize, distFrame.LineSize)
+		if !code.IsNone() {
+			return fmt.Errorf("frame %d: %w", count+opts.start, code.Err())
+		}
+		rep.AddFrame(count+opts.start, jod)
+		if opts.perFrame {
+			fmt.Fprintf(out, "%d\t%.6f\n", count+opts.start, jod)
+		}
+	}
+	if count == 0 {
+		return errors.New("no frames to score")
+	}
+
+	if opts.perFrame {
+		fmt.Fprintln(out)
+	}
+	fmt.Fprintf(out, "frames\t%d\n", count)
+	fmt.Fprintf(out, "JOD\t%.6f\n", jod)
+	rep.SetSequenceScore(jod)
+	return nil
+}
+
+// openY4M opens a y4m file and applies the colorspace overrides.
+func openY4M(path string, opts *scoreOptions) (*vship.Y4MReader, func(),
+	error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	y, err := vship.NewY4MReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	cs := y.Colorspace()
+	if err := applyOverrides(&cs, opts); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err := y.SetColorspace(cs); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return y, func() { f.Close() }, nil
+}
+
+// rangeSource limits a Y4MReader to the frames [start, end). An end of zero
+// reads to the end of the stream.
+type rangeSource struct {
+	src        *vship.Y4MReader
+	start, end int
+	pos        int
+}
+
+func (r *rangeSource) Colorspace() vship.Colorspace {
+	return r.src.Colorspace()
+}
+
+func (r *rangeSource) Rewind() error {
+	r.pos = 0
+	return r.src.Rewind()
+}
+
+func (r *rangeSource) ReadFrame(frame *vship.Frame) error {
+	for ; r.pos < r.start; r.pos++ {
+		if err := r.src.SkipFrame(); err != nil {
+			return err
+		}
+	}
+	if r.end > 0 && r.pos >= r.end {
+		return io.EOF
+	}
+	if err := r.src.ReadFrame(frame); err != nil {
+		return err
+	}
+	r.pos++
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+	"github.com/GreatValueCreamSoda/govship/report"
+)
+
+func Test_RangeSource(t *testing.T) {
+	var data bytes.Buffer
+	data.WriteString("YUV4MPEG2 W4 H2 F25:1 C420jpeg\n")
+	for i := range 6 {
+		data.WriteString("FRAME\n")
+		data.Write(bytes.Repeat([]byte{byte(i)}, 12))
+	}
+	y, err := vship.NewY4MReader(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := &rangeSource{src: y, start: 2, end: 4}
+	var frame vship.Frame
+	var got []byte
+	for {
+		if err := src.ReadFrame(&frame); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, frame.Planes[0][0])
+	}
+	if !bytes.Equal(got, []byte{2, 3}) {
+		t.Fatalf("read frames %v, want [2 3]", got)
+	}
+}
+
+func Test_ApplyOverrides(t *testing.T) {
+	var cs vship.Colorspace
+	cs.SetDefaults(8, 8, vship.SamplingFormatUInt10)
+	opts := scoreOptions{matrix: "BT2020NCL", transfer: "pq",
+		colorRange: "full"}
+	if err := applyOverrides(&cs, &opts); err != nil {
+		t.Fatal(err)
+	}
+	if cs.ColorMatrix != vship.ColorMatrixBT2020NCL ||
+		cs.ColorTransfer != vship.ColorTransferTRCPQ ||
+		cs.ColorRange != vship.ColorRangeFull ||
+		cs.ColorPrimaries != vship.ColorPrimariesBT709 {
+		t.Fatalf("unexpected colorspace %+v", cs)
+	}
+
+	opts = scoreOptions{primaries: "p3"}
+	if err := applyOverrides(&cs, &opts); exitCode(err) != 2 {
+		t.Fatalf("err = %v, want a usage error", err)
+	}
+}
+
+func Test_RunScore_Arguments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.y4m")
+	if err := os.WriteFile(path, []byte("YUV4MPEG2 W4 H2 F25:1\n"),
+		0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{path},
+		{"-metric", "psnr", path, path},
+		{"-start", "5", "-end", "3", path, path},
+		{"-no-such-flag", path, path},
+	} {
+		err := runScore(args, io.Discard)
+		if exitCode(err) != 2 {
+			t.Fatalf("%v: err = %v, want a usage error", args, err)
+		}
+	}
+}
+
+func Test_WriteReport(t *testing.T) {
+	rep := report.New(vship.HandlerSpec{Metric: vship.MetricButteraugli})
+	agg := vship.NewAggregator(vship.AggregatorOptions{})
+	rep.AddButteraugliFrame(0, vship.ButteraugliScore{})
+	agg.AddFrame(0, 0)
+	rep.SetAggregate(agg.Summary())
+
+	dir := t.TempDir()
+	if err := writeReport(filepath.Join(dir, "scores.csv"), rep); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"scores.csv", "scores_aggregate.csv",
+		"scores.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "report.json")
+	if err := writeReport(path, rep); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := report.ReadJSON(f); err != nil {
+		t.Fatal(err)
+	}
+}
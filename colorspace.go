@@ -195,3 +195,65 @@ func (c *Colorspace) SetDefaults(width, height int64, format SamplingFormat) {
 	c.ColorPrimaries = ColorPrimariesBT709
 	c.CropTop, c.CropBottom, c.CropLeft, c.CropRight = 0, 0, 0, 0
 }
+
+// outputSize returns the dimensions libvship works at for an image in this
+// Colorspace, after the crop rectangle is removed and the optional resize to
+// TargetWidth/TargetHeight is applied. Per-pixel outputs such as distortion
+// maps have this size.
+func (c *Colorspace) outputSize() (width, height int) {
+	width = int(c.Width) - c.CropLeft - c.CropRight
+	height = int(c.Height) - c.CropTop - c.CropBottom
+	if c.TargetWidth > 0 {
+		width = int(c.TargetWidth)
+	}
+	if c.TargetHeight > 0 {
+		height = int(c.TargetHeight)
+	}
+	return width, height
+}
+
+// bytesPerSample returns the number of bytes used to store one sample of a
+// plane in memory.
+func (c *Colorspace) bytesPerSample() int {
+	switch c.SamplingFormat {
+	case SamplingFormatFloat:
+		return 4
+	case SamplingFormatUInt8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// bitDepth returns the number of significant bits of integer sample formats
+// and 0 for floating point formats.
+func (c *Colorspace) bitDepth() int {
+	switch c.SamplingFormat {
+	case SamplingFormatUInt8:
+		return 8
+	case SamplingFormatUInt9:
+		return 9
+	case SamplingFormatUInt10:
+		return 10
+	case SamplingFormatUInt12:
+		return 12
+	case SamplingFormatUInt14:
+		return 14
+	case SamplingFormatUInt16:
+		return 16
+	default:
+		return 0
+	}
+}
+
+// planeSize returns the width and height in pixels of plane i of an
+// uncropped image in this Colorspace. Chroma planes of YUV images are reduced
+// by the chroma subsampling, which is stored as a power of two.
+func (c *Colorspace) planeSize(i int) (width, height int) {
+	width, height = int(c.Width), int(c.Height)
+	if i == 0 || c.ColorFamily == ColorFamilyRGB {
+		return width, height
+	}
+	subW, subH := 1<<c.ChromaSubsamplingWidth, 1<<c.ChromaSubsamplingHeight
+	return (width + subW - 1) / subW, (height + subH - 1) / subH
+}
@@ -6,11 +6,62 @@ package govship
 #include "flattened.h"
 */
 import "C"
-import "unsafe"
+import (
+	"encoding/json"
+	"unsafe"
+)
 
 type CVVDPHandler struct {
 	ptr  *C.Vship_CVVDPHandler
 	init bool
+	// Size of the distortion map produced by ComputeScoreWithMap. Zero when
+	// it cannot be determined from the display model.
+	mapWidth, mapHeight int
+	// Configuration the handler was created with, used to create handlers
+	// with identical settings.
+	src, dst             Colorspace
+	fps                  float32
+	resizeToDisplay      bool
+	modelKey, configJSON string
+}
+
+// cvvdpBuiltinResolutions holds the native resolution of CVVDP's built-in
+// display models. It is used to size distortion maps when frames are resized
+// to the display.
+var cvvdpBuiltinResolutions = map[string][2]int{
+	"standard_4k":              {3840, 2160},
+	"standard_fhd":             {1920, 1080},
+	"standard_hdr_pq":          {3840, 2160},
+	"standard_hdr_hlg":         {3840, 2160},
+	"standard_hdr_linear":      {3840, 2160},
+	"standard_hdr_dark":        {3840, 2160},
+	"standard_hdr_linear_zoom": {3840, 2160},
+}
+
+// cvvdpMapSize determines the size of the distortion map CVVDP writes for the
+// given source format and display model. When resizeToDisplay is set the map
+// has the resolution of the display model, which is looked up first in
+// configJSON and then in the built-in models.
+func cvvdpMapSize(src *Colorspace, resizeToDisplay bool, modelKey,
+	configJSON string) (width, height int) {
+	if !resizeToDisplay {
+		return src.outputSize()
+	}
+
+	if configJSON != "" {
+		var models map[string]struct {
+			Resolution [2]int `json:"resolution"`
+		}
+		if json.Unmarshal([]byte(configJSON), &models) == nil {
+			res := models[modelKey].Resolution
+			if res[0] > 0 && res[1] > 0 {
+				return res[0], res[1]
+			}
+		}
+	}
+
+	res := cvvdpBuiltinResolutions[modelKey]
+	return res[0], res[1]
 }
 
 // NewCVVDPHandler initializes a new CVVDP handler using a built-in display
@@ -52,6 +103,9 @@ func NewCVVDPHandler(src, dst *Colorspace, fps float32, resizeToDisplay bool,
 
 	h.ptr = &cHandler
 	h.init = true
+	h.mapWidth, h.mapHeight = cvvdpMapSize(src, resizeToDisplay, modelKey, "")
+	h.src, h.dst, h.fps, h.resizeToDisplay = *src, *dst, fps, resizeToDisplay
+	h.modelKey = modelKey
 	return &h, code
 }
 
@@ -60,7 +114,10 @@ func NewCVVDPHandler(src, dst *Colorspace, fps float32, resizeToDisplay bool,
 //
 // The modelKey selects a display model entry inside the provided JSON
 // configuration. The configJSON string must contain a valid CVVDP display
-// model configuration, typically produced by DisplayModelsToCVVDPJSON.
+// model configuration, typically produced by DisplayModelsToCVVDPJSON or, to
+// adjust a built-in preset, DisplayModelOverridesToCVVDPJSON.
+// NewCVVDPHandlerForModel and CVVDPDisplayConfig build the configuration and
+// key from DisplayModel values.
 //
 // The JSON configuration may define entirely new display models or override
 // specific properties of existing built-in presets. When overriding, CVVDP
@@ -96,9 +153,24 @@ func NewCVVDPHandlerWithConfig(
 
 	h.ptr = &cHandler
 	h.init = true
+	h.mapWidth, h.mapHeight = cvvdpMapSize(src, resizeToDisplay, modelKey,
+		configJSON)
+	h.src, h.dst, h.fps, h.resizeToDisplay = *src, *dst, fps, resizeToDisplay
+	h.modelKey, h.configJSON = modelKey, configJSON
 	return &h, code
 }
 
+// clone creates a new handler with the same configuration as h and a fresh
+// temporal state.
+func (h *CVVDPHandler) clone() (*CVVDPHandler, ExceptionCode) {
+	if h.configJSON == "" {
+		return NewCVVDPHandler(&h.src, &h.dst, h.fps, h.resizeToDisplay,
+			h.modelKey)
+	}
+	return NewCVVDPHandlerWithConfig(&h.src, &h.dst, h.fps,
+		h.resizeToDisplay, h.modelKey, h.configJSON)
+}
+
 // Reset clears the internal temporal frame history maintained by CVVDP.
 //
 // CVVDP is a temporal metric: it accumulates information across multiple
@@ -207,6 +279,37 @@ func (h *CVVDPHandler) ComputeScore(
 	return float64(score), ExceptionCode(code)
 }
 
+// ComputeScoreWithMap submits the current frame(s) like ComputeScore and
+// additionally returns the per-pixel distortion map of the submitted frame.
+//
+// The map has the resolution of the display model when the handler resizes
+// to the display, and the size of the source image after cropping and
+// resizing otherwise, see MapSize. If the resolution of the display model
+// cannot be determined ExceptionCodeBadDisplayModel is returned without
+// submitting the frame.
+func (h *CVVDPHandler) ComputeScoreWithMap(src, distorted [3][]byte,
+	srcLineSize, dstLineSize [3]int64) (float64, *DistortionMap,
+	ExceptionCode) {
+	width, height := h.MapSize()
+	if width <= 0 || height <= 0 {
+		return 0, nil, ExceptionCodeBadDisplayModel
+	}
+
+	dmap := NewDistortionMap(width, height)
+	score, code := h.ComputeScore(dmap.bytes(), dmap.stride(), src, distorted,
+		srcLineSize, dstLineSize)
+	if !code.IsNone() {
+		return 0, nil, code
+	}
+	return score, dmap, code
+}
+
+// MapSize returns the width and height of the distortion maps produced by
+// this handler, or zero if they are unknown for the handler's display model.
+func (h *CVVDPHandler) MapSize() (width, height int) {
+	return h.mapWidth, h.mapHeight
+}
+
 // Close releases all native resources associated with the CVVDP handler.
 //
 // After Close is called, the handler must not be used again. Calling Close
@@ -0,0 +1,72 @@
+package govship
+
+import "slices"
+
+// customDisplayModelKey is the key NewCVVDPHandlerForModel gives models that
+// have none.
+const customDisplayModelKey = "custom"
+
+// CVVDPDisplayConfig is a CVVDP display model configuration built once from
+// DisplayModel values and shared by any number of handlers, for example one
+// per worker. It is immutable and safe for concurrent use.
+type CVVDPDisplayConfig struct {
+	json string
+	keys []string
+}
+
+// NewCVVDPDisplayConfig builds a configuration holding models, keyed as by
+// DisplayModelsToCVVDPJSON. Every model must pass Validate.
+func NewCVVDPDisplayConfig(models ...DisplayModel) (*CVVDPDisplayConfig,
+	error) {
+	keys := make([]string, len(models))
+	for i, m := range models {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+		keys[i] = displayModelKey(m, i)
+	}
+	data, err := DisplayModelsToCVVDPJSON(models)
+	if err != nil {
+		return nil, err
+	}
+	return &CVVDPDisplayConfig{json: string(data), keys: keys}, nil
+}
+
+// JSON returns the configuration as passed to NewCVVDPHandlerWithConfig.
+func (c *CVVDPDisplayConfig) JSON() string { return c.json }
+
+// Keys returns the keys of the models in the configuration, in the order
+// the models were given.
+func (c *CVVDPDisplayConfig) Keys() []string { return slices.Clone(c.keys) }
+
+// NewHandler initializes a CVVDP handler for the model stored under key, see
+// NewCVVDPHandlerWithConfig. ExceptionCodeBadDisplayModel is returned
+// without calling Vship if the configuration holds no such model.
+func (c *CVVDPDisplayConfig) NewHandler(src, dst *Colorspace, fps float32,
+	resizeToDisplay bool, key string) (*CVVDPHandler, ExceptionCode) {
+	if !slices.Contains(c.keys, key) {
+		return nil, ExceptionCodeBadDisplayModel
+	}
+	return NewCVVDPHandlerWithConfig(src, dst, fps, resizeToDisplay, key,
+		c.json)
+}
+
+// NewCVVDPHandlerForModel initializes a CVVDP handler for a display model
+// value, generating the configuration and key NewCVVDPHandlerWithConfig
+// needs. A model without a Key is stored under "custom"; one with the key of
+// a built-in CVVDP model replaces it. Models failing Validate are rejected
+// with ExceptionCodeBadDisplayModel.
+//
+// To create many handlers for the same model, build a CVVDPDisplayConfig
+// once instead.
+func NewCVVDPHandlerForModel(src, dst *Colorspace, fps float32,
+	resizeToDisplay bool, model DisplayModel) (*CVVDPHandler, ExceptionCode) {
+	if model.Key == "" {
+		model.Key = customDisplayModelKey
+	}
+	config, err := NewCVVDPDisplayConfig(model)
+	if err != nil {
+		return nil, ExceptionCodeBadDisplayModel
+	}
+	return config.NewHandler(src, dst, fps, resizeToDisplay, model.Key)
+}
@@ -0,0 +1,72 @@
+package govship_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_CVVDPDisplayConfig(t *testing.T) {
+	unnamed := vship.DisplayModelPresetTablet
+	unnamed.Key = ""
+	config, err := vship.NewCVVDPDisplayConfig(
+		vship.DisplayModelPresetSmartphone, unnamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := config.Keys()
+	if !slices.Equal(keys, []string{"smartphone_30cm", unnamed.Name}) {
+		t.Fatalf("keys = %v", keys)
+	}
+
+	parsed, err := vship.ParseCVVDPDisplayModels([]byte(config.JSON()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if _, ok := parsed.Models[key]; !ok {
+			t.Fatalf("configuration lacks %q", key)
+		}
+	}
+
+	var cs vship.Colorspace
+	cs.SetDefaults(64, 64, vship.SamplingFormatUInt8)
+	if _, code := config.NewHandler(&cs, &cs, 30, false,
+		"standard_4k"); code != vship.ExceptionCodeBadDisplayModel {
+		t.Fatalf("unknown key returned %v", code)
+	}
+
+	bad := vship.DisplayModelPresetSmartphone
+	bad.DisplayDiagonalSizeInches = 0
+	if _, err := vship.NewCVVDPDisplayConfig(bad); err == nil {
+		t.Fatal("invalid model accepted")
+	}
+	if _, code := vship.NewCVVDPHandlerForModel(&cs, &cs, 30, false,
+		bad); code != vship.ExceptionCodeBadDisplayModel {
+		t.Fatalf("invalid model returned %v", code)
+	}
+}
+
+func Test_CVVDPDisplayConfig_UnsetExposure(t *testing.T) {
+	// Upstream display models leave exposure out, which parses as zero.
+	parsed, err := vship.ParseCVVDPDisplayModels([]byte(`{"standard_4k": {
+		"resolution": [3840, 2160], "viewing_distance_meters": 0.7472,
+		"diagonal_size_inches": 30, "max_luminance": 200,
+		"contrast": 1000, "E_ambient": 250, "k_refl": 0.005}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := parsed.Models["standard_4k"]
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	config, err := vship.NewCVVDPDisplayConfig(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(config.JSON(), "exposure") {
+		t.Fatalf("an unset exposure was written:\n%s", config.JSON())
+	}
+}
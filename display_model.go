@@ -2,6 +2,7 @@ package govship
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 )
@@ -30,6 +31,10 @@ const (
 // visual sensitivity, contrast masking, and adaptation. Values should reflect
 // real viewing conditions rather than arbitrary display specifications.
 type DisplayModel struct {
+	// Identifier of the model in a CVVDP display model file, the key passed
+	// to NewCVVDPHandlerWithConfig. Models with the key of a built-in CVVDP
+	// model replace it.
+	Key string
 	// Human-readable description of the display and viewing setup.
 	Name string
 	// Perceptual colorspace of the display (HDR or SDR). This is used as
@@ -65,7 +70,8 @@ type DisplayModel struct {
 	// 100%
 	AmbientLightReflectionOnDisplay float32
 	// Exposure is a global perceptual scaling factor. This should almost
-	// always be set to 1, matching CVVDP reference conditions.
+	// always be set to 1, matching CVVDP reference conditions. Zero leaves
+	// it unset, so CVVDP uses its default of 1.
 	Exposure float32
 }
 
@@ -76,6 +82,7 @@ var (
 	// DisplayModelPresetStandard4K models a typical SDR 4K monitor viewed
 	// under office lighting conditions.
 	DisplayModelPresetStandard4K DisplayModel = DisplayModel{
+		Key: "standard_4k",
 		Name: "30-inch 4K monitor, peak luminance 200 cd/m^2, viewed under " +
 			"office light levels (250 lux), seen from 2 x display height",
 		ColorSpace:                      DisplayModelColorspaceSDR,
@@ -90,17 +97,19 @@ var (
 		Exposure:                        1,
 	}
 
-	// DisplayModelPresetStandardFHD models a typical SDR Full HD display under
-	// the same viewing conditions as the 4K preset.
+	// DisplayModelPresetStandardFHD models a typical SDR Full HD desktop
+	// monitor under the same viewing conditions as the 4K preset.
 	DisplayModelPresetStandardFHD DisplayModel = DisplayModel{
-		Name: "30-inch 4K monitor, peak luminance 200 cd/m^2, viewed under " +
-			"office light levels (250 lux), seen from 2 x display height",
+		Key: "standard_fhd",
+		Name: "24-inch Full HD monitor, peak luminance 200 cd/m^2, viewed " +
+			"under office light levels (250 lux), seen from 2 x display " +
+			"height",
 		ColorSpace:                      DisplayModelColorspaceSDR,
 		DisplayWidth:                    1920,
 		DisplayHeight:                   1080,
 		DisplayMaxLuminance:             200,
-		DisplayDiagonalSizeInches:       30,
-		ViewingDistanceMeters:           0.7472,
+		DisplayDiagonalSizeInches:       24,
+		ViewingDistanceMeters:           0.5978,
 		MonitorContrastRatio:            1000,
 		AmbientLightLevel:               250,
 		AmbientLightReflectionOnDisplay: 0.005,
@@ -110,6 +119,7 @@ var (
 	// DisplayModelPresetStandardHDR models a bright HDR monitor viewed in a
 	// low-light environment.
 	DisplayModelPresetStandardHDR DisplayModel = DisplayModel{
+		Key: "standard_hdr_pq",
 		Name: "30-inch 4K HDR monitor, peak luminance 1500 cd/m^2, viewed " +
 			"under low light levels (10 lux), seen from 2 x display height",
 		ColorSpace:                      DisplayModelColorspaceHDR,
@@ -127,8 +137,9 @@ var (
 	// DisplayModelPresetStandardHDRDarkRoom models an HDR display viewed in a
 	// near-dark environment with minimal ambient light.
 	DisplayModelPresetStandardHDRDarkRoom DisplayModel = DisplayModel{
+		Key: "standard_hdr_dark",
 		Name: "30-inch 4K HDR monitor, peak luminance 1500 cd/m^2, viewed " +
-			"under low light levels (10 lux), seen from 2 x display height",
+			"in a dark room (0 lux), seen from 2 x display height",
 		ColorSpace:                      DisplayModelColorspaceHDR,
 		DisplayWidth:                    3840,
 		DisplayHeight:                   2160,
@@ -142,56 +153,203 @@ var (
 	}
 )
 
+// DisplayModelOverride is a partial DisplayModel. Only the fields that are
+// set are written to CVVDP, so zero values can be given on purpose and a
+// built-in CVVDP model can be adjusted without restating all of it. Ptr
+// helps setting fields from constants.
+type DisplayModelOverride struct {
+	// Key of the model to define or override, e.g. "standard_fhd".
+	Key string
+	// Fields of the model, see DisplayModel. Nil leaves the field unset.
+	Name       *string
+	ColorSpace *DisplayModelColorspace
+	// Resolution of the display. Width and height must be set together.
+	DisplayWidth, DisplayHeight     *int
+	DisplayMaxLuminance             *float32
+	DisplayDiagonalSizeInches       *float32
+	ViewingDistanceMeters           *float32
+	MonitorContrastRatio            *int
+	AmbientLightLevel               *int
+	AmbientLightReflectionOnDisplay *float32
+	Exposure                        *float32
+}
+
+// Ptr returns a pointer to a copy of v, for setting DisplayModelOverride
+// fields.
+func Ptr[T any](v T) *T { return &v }
+
+// Override returns an override with every field of m set, except for an
+// Exposure of zero which is left unset. The key is the Key of m, or its Name
+// if it has none.
+func (m DisplayModel) Override() DisplayModelOverride {
+	o := DisplayModelOverride{
+		Key:                             m.Key,
+		Name:                            &m.Name,
+		ColorSpace:                      &m.ColorSpace,
+		DisplayWidth:                    &m.DisplayWidth,
+		DisplayHeight:                   &m.DisplayHeight,
+		DisplayMaxLuminance:             &m.DisplayMaxLuminance,
+		DisplayDiagonalSizeInches:       &m.DisplayDiagonalSizeInches,
+		ViewingDistanceMeters:           &m.ViewingDistanceMeters,
+		MonitorContrastRatio:            &m.MonitorContrastRatio,
+		AmbientLightLevel:               &m.AmbientLightLevel,
+		AmbientLightReflectionOnDisplay: &m.AmbientLightReflectionOnDisplay,
+	}
+	if o.Key == "" {
+		o.Key = m.Name
+	}
+	if m.Exposure != 0 {
+		o.Exposure = &m.Exposure
+	}
+	return o
+}
+
+// Apply returns base with the fields set in o replaced. The key of base is
+// kept.
+func (o DisplayModelOverride) Apply(base DisplayModel) DisplayModel {
+	if o.Name != nil {
+		base.Name = *o.Name
+	}
+	if o.ColorSpace != nil {
+		base.ColorSpace = *o.ColorSpace
+	}
+	if o.DisplayWidth != nil {
+		base.DisplayWidth = *o.DisplayWidth
+	}
+	if o.DisplayHeight != nil {
+		base.DisplayHeight = *o.DisplayHeight
+	}
+	if o.DisplayMaxLuminance != nil {
+		base.DisplayMaxLuminance = *o.DisplayMaxLuminance
+	}
+	if o.DisplayDiagonalSizeInches != nil {
+		base.DisplayDiagonalSizeInches = *o.DisplayDiagonalSizeInches
+	}
+	if o.ViewingDistanceMeters != nil {
+		base.ViewingDistanceMeters = *o.ViewingDistanceMeters
+	}
+	if o.MonitorContrastRatio != nil {
+		base.MonitorContrastRatio = *o.MonitorContrastRatio
+	}
+	if o.AmbientLightLevel != nil {
+		base.AmbientLightLevel = *o.AmbientLightLevel
+	}
+	if o.AmbientLightReflectionOnDisplay != nil {
+		base.AmbientLightReflectionOnDisplay =
+			*o.AmbientLightReflectionOnDisplay
+	}
+	if o.Exposure != nil {
+		base.Exposure = *o.Exposure
+	}
+	return base
+}
+
 // cvvdpDisplayJSON is an internal representation matching the JSON schema
-// expected by CVVDP display model configuration files.
+// expected by CVVDP display model configuration files. Nil fields are left
+// out.
 //
 // This type is not exported and should not be relied upon directly.
 type cvvdpDisplayJSON struct {
-	Name                  string  `json:"name,omitempty"`
-	ColorSpace            string  `json:"colorspace,omitempty"`
-	Resolution            [2]int  `json:"resolution,omitempty"`
-	MaxLuminance          float32 `json:"max_luminance,omitempty"`
-	ViewingDistanceMeters float32 `json:"viewing_distance_meters,omitempty"`
-	DiagonalSizeInches    float32 `json:"diagonal_size_inches,omitempty"`
-	Contrast              float32 `json:"contrast,omitempty"`
-	EAmbient              float32 `json:"E_ambient,omitempty"`
-	KRefl                 float32 `json:"k_refl,omitempty"`
-	Exposure              float32 `json:"exposure,omitempty"`
-	Source                string  `json:"source,omitempty"`
+	Name                  *string  `json:"name,omitempty"`
+	ColorSpace            *string  `json:"colorspace,omitempty"`
+	Resolution            *[2]int  `json:"resolution,omitempty"`
+	MaxLuminance          *float32 `json:"max_luminance,omitempty"`
+	ViewingDistanceMeters *float32 `json:"viewing_distance_meters,omitempty"`
+	DiagonalSizeInches    *float32 `json:"diagonal_size_inches,omitempty"`
+	Contrast              *int     `json:"contrast,omitempty"`
+	EAmbient              *int     `json:"E_ambient,omitempty"`
+	KRefl                 *float32 `json:"k_refl,omitempty"`
+	Exposure              *float32 `json:"exposure,omitempty"`
+	Source                string   `json:"source,omitempty"`
+}
+
+// marshalCVVDPModels encodes overrides keyed by their Key, giving each the
+// source string if it is not empty.
+func marshalCVVDPModels(overrides []DisplayModelOverride, source string,
+) ([]byte, error) {
+	out := make(map[string]cvvdpDisplayJSON, len(overrides))
+	for _, o := range overrides {
+		if o.Key == "" {
+			return nil, errors.New("display model without a key")
+		}
+		if _, ok := out[o.Key]; ok {
+			return nil, fmt.Errorf("duplicate display model key %q", o.Key)
+		}
+		var res *[2]int
+		switch {
+		case o.DisplayWidth != nil && o.DisplayHeight != nil:
+			res = &[2]int{*o.DisplayWidth, *o.DisplayHeight}
+		case o.DisplayWidth != nil || o.DisplayHeight != nil:
+			return nil, fmt.Errorf("display model %q: width and height "+
+				"must be set together", o.Key)
+		}
+		var colorSpace *string
+		if o.ColorSpace != nil {
+			colorSpace = (*string)(o.ColorSpace)
+		}
+		out[o.Key] = cvvdpDisplayJSON{
+			Name:                  o.Name,
+			ColorSpace:            colorSpace,
+			Resolution:            res,
+			MaxLuminance:          o.DisplayMaxLuminance,
+			ViewingDistanceMeters: o.ViewingDistanceMeters,
+			DiagonalSizeInches:    o.DisplayDiagonalSizeInches,
+			Contrast:              o.MonitorContrastRatio,
+			EAmbient:              o.AmbientLightLevel,
+			KRefl:                 o.AmbientLightReflectionOnDisplay,
+			Exposure:              o.Exposure,
+			Source:                source,
+		}
+	}
+	return json.MarshalIndent(out, "", "    ")
 }
 
 // DisplayModelsToCVVDPJSON converts a set of DisplayModel definitions into a
 // CVVDP-compatible JSON configuration.
 //
-// The input map key becomes the display identifier in the JSON file. The
-// resulting JSON can be written directly to disk and passed to
+// The Key of each model becomes the display identifier in the JSON file,
+// falling back to its Name and then to "display-<index>". Every field is
+// written, zero or not, apart from an Exposure of zero which CVVDP takes as
+// 1. The resulting JSON can be written directly to disk and passed to
 // NewCVVDPHandlerWithConfig as a custom display model configuration file for
 // custom display model presets.
+//
+// Earlier versions keyed models by Name only and left zero fields out. Both
+// changed: the presets are now written under their Key, such as
+// "standard_4k", and a partial model such as {Name, ColorSpace} now writes a
+// resolution of [0, 0] and a peak luminance and contrast of 0 instead of
+// keeping the values of the model it overrides. Partial models must use
+// DisplayModelOverridesToCVVDPJSON, which writes only the fields that are
+// set.
 func DisplayModelsToCVVDPJSON(models []DisplayModel) ([]byte, error) {
-	out := make(map[string]cvvdpDisplayJSON)
-
+	overrides := make([]DisplayModelOverride, len(models))
 	for i, m := range models {
-		key := m.Name
-		if key == "" {
-			// fallback if Name is empty
-			key = fmt.Sprintf("display-%d", i)
-		}
-		out[key] = cvvdpDisplayJSON{
-			Name:                  m.Name,
-			ColorSpace:            string(m.ColorSpace),
-			Resolution:            [2]int{m.DisplayWidth, m.DisplayHeight},
-			MaxLuminance:          m.DisplayMaxLuminance,
-			ViewingDistanceMeters: m.ViewingDistanceMeters,
-			DiagonalSizeInches:    m.DisplayDiagonalSizeInches,
-			Contrast:              float32(m.MonitorContrastRatio),
-			EAmbient:              float32(m.AmbientLightLevel),
-			KRefl:                 m.AmbientLightReflectionOnDisplay,
-			Exposure:              m.Exposure,
-			Source:                "none",
-		}
+		m.Key = displayModelKey(m, i)
+		overrides[i] = m.Override()
 	}
+	return marshalCVVDPModels(overrides, "none")
+}
 
-	return json.MarshalIndent(out, "", "    ")
+// displayModelKey returns the key of the i-th model written by
+// DisplayModelsToCVVDPJSON.
+func displayModelKey(m DisplayModel, i int) string {
+	switch {
+	case m.Key != "":
+		return m.Key
+	case m.Name != "":
+		return m.Name
+	}
+	// fallback if Key and Name are empty
+	return fmt.Sprintf("display-%d", i)
+}
+
+// DisplayModelOverridesToCVVDPJSON converts a set of partial display models
+// into a CVVDP-compatible JSON configuration holding only the fields that
+// are set. Every override needs a Key; overriding a built-in key such as
+// "standard_fhd" adjusts that model.
+func DisplayModelOverridesToCVVDPJSON(overrides []DisplayModelOverride,
+) ([]byte, error) {
+	return marshalCVVDPModels(overrides, "")
 }
 
 // DisplayModelsToCVVDPJSONFile writes a set of DisplayModel definitions
@@ -0,0 +1,124 @@
+package govship
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// metersPerInch converts the diagonal of a display to meters.
+const metersPerInch = 0.0254
+
+// maxDisplayAspect bounds the aspect ratio of a display resolution, wider
+// than any 32:9 monitor or 21:9 phone held either way.
+const maxDisplayAspect = 4
+
+// Validate reports physically implausible values in m, joining one error per
+// problem. Key, Name and ColorSpace are not checked.
+//
+// DisplayModel has no physical width or height, so the geometry helpers
+// assume square pixels and derive the shape of the screen from the
+// resolution; resolutions with an aspect ratio beyond 4:1 are rejected.
+func (m DisplayModel) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("display model %q: "+format,
+				append([]any{m.Key}, args...)...))
+		}
+	}
+
+	check(m.DisplayWidth > 0 && m.DisplayHeight > 0,
+		"resolution %dx%d is not positive", m.DisplayWidth, m.DisplayHeight)
+	if m.DisplayWidth > 0 && m.DisplayHeight > 0 {
+		aspect := float64(m.DisplayWidth) / float64(m.DisplayHeight)
+		check(aspect <= maxDisplayAspect && aspect >= 1/maxDisplayAspect,
+			"resolution %dx%d has an implausible aspect ratio",
+			m.DisplayWidth, m.DisplayHeight)
+	}
+	check(m.DisplayMaxLuminance > 0, "peak luminance %g is not positive",
+		m.DisplayMaxLuminance)
+	check(m.DisplayDiagonalSizeInches > 0, "diagonal %g is not positive",
+		m.DisplayDiagonalSizeInches)
+	check(m.ViewingDistanceMeters > 0, "viewing distance %g is not positive",
+		m.ViewingDistanceMeters)
+	check(m.MonitorContrastRatio >= 1, "contrast ratio %d is below 1",
+		m.MonitorContrastRatio)
+	check(m.AmbientLightLevel >= 0, "ambient light %d is negative",
+		m.AmbientLightLevel)
+	check(m.AmbientLightReflectionOnDisplay >= 0 &&
+		m.AmbientLightReflectionOnDisplay <= 1,
+		"reflectance %g is outside [0, 1]", m.AmbientLightReflectionOnDisplay)
+	check(m.Exposure >= 0, "exposure %g is negative", m.Exposure)
+	return errors.Join(errs...)
+}
+
+// DisplayWidthMeters returns the physical width of the display, derived from
+// its diagonal and resolution. It is zero if either is unset.
+func (m DisplayModel) DisplayWidthMeters() float64 {
+	return m.displaySize(m.DisplayWidth)
+}
+
+// DisplayHeightMeters returns the physical height of the display, derived
+// from its diagonal and resolution. It is zero if either is unset.
+func (m DisplayModel) DisplayHeightMeters() float64 {
+	return m.displaySize(m.DisplayHeight)
+}
+
+// displaySize scales the diagonal by pixels over the diagonal in pixels.
+func (m DisplayModel) displaySize(pixels int) float64 {
+	diagonal := math.Hypot(float64(m.DisplayWidth), float64(m.DisplayHeight))
+	if diagonal == 0 {
+		return 0
+	}
+	return float64(m.DisplayDiagonalSizeInches) * metersPerInch *
+		float64(pixels) / diagonal
+}
+
+// ViewingDistanceFromHeights returns the distance at which the display is
+// seen from n times its height, the usual way of stating viewing conditions.
+// The built-in presets use 2, giving 0.7472 m for a 30-inch 16:9 display.
+func (m DisplayModel) ViewingDistanceFromHeights(n float64) float32 {
+	return float32(n * m.DisplayHeightMeters())
+}
+
+// ViewingDistanceInHeights returns the viewing distance as a multiple of the
+// display height. It is zero if the height is unknown.
+func (m DisplayModel) ViewingDistanceInHeights() float64 {
+	height := m.DisplayHeightMeters()
+	if height == 0 {
+		return 0
+	}
+	return float64(m.ViewingDistanceMeters) / height
+}
+
+// FieldOfView returns the horizontal and vertical angles in degrees the
+// display covers from the viewing distance.
+func (m DisplayModel) FieldOfView() (horizontal, vertical float64) {
+	return m.visualAngle(m.DisplayWidthMeters()),
+		m.visualAngle(m.DisplayHeightMeters())
+}
+
+// PixelsPerDegree returns the number of pixels per degree of visual angle at
+// the center of the display, the resolution CVVDP models the observer with.
+// It is zero if the geometry is incomplete.
+func (m DisplayModel) PixelsPerDegree() float64 {
+	if m.DisplayWidth <= 0 {
+		return 0
+	}
+	pixel := m.visualAngle(m.DisplayWidthMeters() / float64(m.DisplayWidth))
+	if pixel == 0 {
+		return 0
+	}
+	return 1 / pixel
+}
+
+// visualAngle returns the angle in degrees covered by size meters centered
+// in front of the viewer.
+func (m DisplayModel) visualAngle(size float64) float64 {
+	if m.ViewingDistanceMeters <= 0 {
+		return 0
+	}
+	return 2 * math.Atan(size/2/float64(m.ViewingDistanceMeters)) *
+		180 / math.Pi
+}
@@ -0,0 +1,76 @@
+package govship_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func near(a, b, tolerance float64) bool { return math.Abs(a-b) <= tolerance }
+
+func Test_DisplayModel_Validate(t *testing.T) {
+	for _, preset := range []vship.DisplayModel{
+		vship.DisplayModelPresetStandard4K,
+		vship.DisplayModelPresetStandardFHD,
+		vship.DisplayModelPresetStandardHDR,
+		vship.DisplayModelPresetStandardHDRDarkRoom,
+	} {
+		if err := preset.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bad := vship.DisplayModelPresetStandard4K
+	bad.DisplayMaxLuminance = -1
+	bad.DisplayDiagonalSizeInches = 0
+	bad.MonitorContrastRatio = 0
+	bad.AmbientLightReflectionOnDisplay = 1.5
+	bad.DisplayWidth, bad.DisplayHeight = 10000, 100
+	bad.Exposure = -1
+	err := bad.Validate()
+	if err == nil {
+		t.Fatal("invalid model accepted")
+	}
+	for _, want := range []string{"peak luminance", "diagonal", "contrast",
+		"reflectance", "aspect ratio", "exposure"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func Test_DisplayModel_Geometry(t *testing.T) {
+	m := vship.DisplayModelPresetStandard4K
+	if h := m.DisplayHeightMeters(); !near(h, 0.3736, 1e-4) {
+		t.Fatalf("height = %v, want 0.3736", h)
+	}
+	if w := m.DisplayWidthMeters(); !near(w, 0.6641, 1e-4) {
+		t.Fatalf("width = %v, want 0.6641", w)
+	}
+	if d := m.ViewingDistanceFromHeights(2); !near(float64(d), 0.7472,
+		1e-4) {
+		t.Fatalf("distance at 2 heights = %v, want 0.7472", d)
+	}
+	if n := m.ViewingDistanceInHeights(); !near(n, 2, 1e-3) {
+		t.Fatalf("distance = %v heights, want 2", n)
+	}
+
+	horizontal, vertical := m.FieldOfView()
+	if !near(horizontal, 47.92, 0.01) || !near(vertical, 28.07, 0.01) {
+		t.Fatalf("field of view = %v x %v", horizontal, vertical)
+	}
+	// Halving the resolution at the same size halves the pixel density.
+	fhd := m
+	fhd.DisplayWidth, fhd.DisplayHeight = 1920, 1080
+	if ppd, half := m.PixelsPerDegree(),
+		fhd.PixelsPerDegree(); !near(ppd, 2*half, 0.01) ||
+		!near(ppd, 75.4, 0.1) {
+		t.Fatalf("pixels per degree = %v (4K), %v (FHD)", ppd, half)
+	}
+
+	if (vship.DisplayModel{}).PixelsPerDegree() != 0 {
+		t.Fatal("an empty model should have no pixel density")
+	}
+}
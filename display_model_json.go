@@ -0,0 +1,207 @@
+package govship
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// CVVDPDisplayModels holds the display models of a CVVDP display model file,
+// such as display_models.json shipped with ColorVideoVDP.
+//
+// Models are keyed by their identifier in the file, the key passed to
+// NewCVVDPHandlerWithConfig. They can be edited, added or removed and written
+// back with MarshalJSON. Everything DisplayModel cannot represent, such as
+// unknown keys or a structured "source" entry, is kept from the parsed file
+// and written back unchanged, and fields present in the file are written
+// back even when they are zero.
+type CVVDPDisplayModels struct {
+	Models map[string]DisplayModel
+	// raw is the original JSON object of each parsed model.
+	raw map[string]map[string]json.RawMessage
+}
+
+// cvvdpModelField is a key of a CVVDP display model that maps to a
+// DisplayModel field, with accessors converting between the two.
+type cvvdpModelField struct {
+	key string
+	get func(m *DisplayModel) any
+	set func(m *DisplayModel, data json.RawMessage) error
+}
+
+// cvvdpModelFields lists the keys of a CVVDP display model that map to
+// DisplayModel fields.
+var cvvdpModelFields = []cvvdpModelField{
+	{"name", func(m *DisplayModel) any { return m.Name },
+		func(m *DisplayModel, d json.RawMessage) error {
+			return json.Unmarshal(d, &m.Name)
+		}},
+	{"colorspace", func(m *DisplayModel) any { return m.ColorSpace },
+		func(m *DisplayModel, d json.RawMessage) error {
+			return json.Unmarshal(d, &m.ColorSpace)
+		}},
+	{"resolution", func(m *DisplayModel) any {
+		return [2]int{m.DisplayWidth, m.DisplayHeight}
+	}, func(m *DisplayModel, d json.RawMessage) error {
+		var res [2]int
+		err := json.Unmarshal(d, &res)
+		m.DisplayWidth, m.DisplayHeight = res[0], res[1]
+		return err
+	}},
+	{"max_luminance", func(m *DisplayModel) any {
+		return m.DisplayMaxLuminance
+	}, func(m *DisplayModel, d json.RawMessage) error {
+		return json.Unmarshal(d, &m.DisplayMaxLuminance)
+	}},
+	{"viewing_distance_meters", func(m *DisplayModel) any {
+		return m.ViewingDistanceMeters
+	}, func(m *DisplayModel, d json.RawMessage) error {
+		return json.Unmarshal(d, &m.ViewingDistanceMeters)
+	}},
+	{"diagonal_size_inches", func(m *DisplayModel) any {
+		return m.DisplayDiagonalSizeInches
+	}, func(m *DisplayModel, d json.RawMessage) error {
+		return json.Unmarshal(d, &m.DisplayDiagonalSizeInches)
+	}},
+	{"contrast", func(m *DisplayModel) any {
+		return m.MonitorContrastRatio
+	}, func(m *DisplayModel, d json.RawMessage) error {
+		return unmarshalRoundedInt(d, &m.MonitorContrastRatio)
+	}},
+	{"E_ambient", func(m *DisplayModel) any { return m.AmbientLightLevel },
+		func(m *DisplayModel, d json.RawMessage) error {
+			return unmarshalRoundedInt(d, &m.AmbientLightLevel)
+		}},
+	{"k_refl", func(m *DisplayModel) any {
+		return m.AmbientLightReflectionOnDisplay
+	}, func(m *DisplayModel, d json.RawMessage) error {
+		return json.Unmarshal(d, &m.AmbientLightReflectionOnDisplay)
+	}},
+	{"exposure", func(m *DisplayModel) any { return m.Exposure },
+		func(m *DisplayModel, d json.RawMessage) error {
+			return json.Unmarshal(d, &m.Exposure)
+		}},
+}
+
+// unmarshalRoundedInt decodes a JSON number into an int, rounding numbers
+// with a fractional part such as 1e6 written as 1000000.0.
+func unmarshalRoundedInt(data json.RawMessage, dst *int) error {
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*dst = int(math.Round(v))
+	return nil
+}
+
+// ParseCVVDPDisplayModels parses a CVVDP display model file. The Key of each
+// model is set to its identifier.
+//
+// The colorspace string is kept as it is, so values of the upstream file
+// such as "sRGB" or "BT.2020-PQ" survive a round trip even though they are
+// not among the DisplayModelColorspace constants. Contrast and ambient light
+// are rounded to integers in Models; MarshalJSON writes back the original
+// numbers as long as the rounded values are not changed.
+func ParseCVVDPDisplayModels(data []byte) (*CVVDPDisplayModels, error) {
+	var raw map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing display models: %w", err)
+	}
+
+	f := &CVVDPDisplayModels{Models: make(map[string]DisplayModel, len(raw)),
+		raw: raw}
+	for key, fields := range raw {
+		m := DisplayModel{Key: key}
+		for _, field := range cvvdpModelFields {
+			value, ok := fields[field.key]
+			if !ok || string(value) == "null" {
+				continue
+			}
+			if err := field.set(&m, value); err != nil {
+				return nil, fmt.Errorf("display model %q: invalid %s: %w",
+					key, field.key, err)
+			}
+		}
+		f.Models[key] = m
+	}
+	return f, nil
+}
+
+// LoadCVVDPDisplayModelsFile reads and parses a CVVDP display model file.
+func LoadCVVDPDisplayModelsFile(path string) (*CVVDPDisplayModels, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCVVDPDisplayModels(data)
+}
+
+// MarshalJSON encodes the models in the CVVDP display model format.
+//
+// Models are written under their key in Models, regardless of their Key
+// field. A field is written if it is present in the parsed file or if it is
+// not zero, and keeps its text from the file if its value was not changed.
+// Models that were not parsed from a file get a "source" of "none" as
+// DisplayModelsToCVVDPJSON writes.
+func (f *CVVDPDisplayModels) MarshalJSON() ([]byte, error) {
+	out := make(map[string]map[string]json.RawMessage, len(f.Models))
+	for key, m := range f.Models {
+		fields := make(map[string]json.RawMessage)
+		original, parsed := f.raw[key]
+		for k, v := range original {
+			fields[k] = v
+		}
+		if !parsed {
+			fields["source"] = json.RawMessage(`"none"`)
+		}
+
+		for _, field := range cvvdpModelFields {
+			value, err := json.Marshal(field.get(&m))
+			if err != nil {
+				return nil, err
+			}
+			raw, present := original[field.key]
+			if present && unchangedField(field, raw, value) {
+				// Keep the number as written, such as a fractional
+				// contrast that DisplayModel rounds.
+				continue
+			}
+			if present || !isZeroJSON(value) {
+				fields[field.key] = value
+			}
+		}
+		out[key] = fields
+	}
+	return json.MarshalIndent(out, "", "    ")
+}
+
+// WriteFile writes the models to a file in the CVVDP display model format.
+func (f *CVVDPDisplayModels) WriteFile(path string) error {
+	data, err := f.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// unchangedField reports whether value, the encoding of field in an edited
+// model, is what raw, the field as parsed from the file, decodes to.
+func unchangedField(field cvvdpModelField, raw json.RawMessage,
+	value []byte) bool {
+	var parsed DisplayModel
+	if string(raw) == "null" || field.set(&parsed, raw) != nil {
+		return false
+	}
+	encoded, err := json.Marshal(field.get(&parsed))
+	return err == nil && string(encoded) == string(value)
+}
+
+// isZeroJSON reports whether data encodes the zero value of a model field.
+func isZeroJSON(data []byte) bool {
+	switch string(data) {
+	case `""`, "0", "[0,0]":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package govship_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// upstreamDisplayModels follows the layout of the display_models.json file
+// shipped with ColorVideoVDP.
+const upstreamDisplayModels = `{
+    "standard_4k": {
+        "name": "30-inch 4K monitor",
+        "resolution": [3840, 2160],
+        "viewing_distance_meters": 0.7472,
+        "diagonal_size_inches": 30,
+        "max_luminance": 200,
+        "contrast": 1000,
+        "E_ambient": 250,
+        "k_refl": 0.005,
+        "source": "none"
+    },
+    "standard_hdr_pq_dark": {
+        "name": "30-inch 4K HDR monitor in a dark room",
+        "colorspace": "BT.2020-PQ",
+        "resolution": [3840, 2160],
+        "viewing_distance_meters": 0.7472,
+        "diagonal_size_inches": 30,
+        "max_luminance": 1500,
+        "contrast": 1000000.0,
+        "E_ambient": 0,
+        "source": {"url": "https://example.com/hdr", "comment": "measured"}
+    },
+    "htc_vive_pro": {
+        "name": "HTC Vive Pro",
+        "resolution": [1440, 1600],
+        "fov_diagonal": 110,
+        "max_luminance": 140,
+        "contrast": 1000,
+        "E_ambient": 0
+    }
+}`
+
+func Test_ParseCVVDPDisplayModels(t *testing.T) {
+	f, err := vship.ParseCVVDPDisplayModels([]byte(upstreamDisplayModels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Models) != 3 {
+		t.Fatalf("parsed %d models, want 3", len(f.Models))
+	}
+
+	hdr := f.Models["standard_hdr_pq_dark"]
+	want := vship.DisplayModel{
+		Key:                       "standard_hdr_pq_dark",
+		Name:                      "30-inch 4K HDR monitor in a dark room",
+		ColorSpace:                "BT.2020-PQ",
+		DisplayWidth:              3840,
+		DisplayHeight:             2160,
+		DisplayMaxLuminance:       1500,
+		DisplayDiagonalSizeInches: 30,
+		ViewingDistanceMeters:     0.7472,
+		MonitorContrastRatio:      1000000,
+	}
+	if hdr != want {
+		t.Fatalf("standard_hdr_pq_dark = %+v, want %+v", hdr, want)
+	}
+
+	if _, err := vship.ParseCVVDPDisplayModels([]byte(
+		`{"bad": {"resolution": "4k"}}`)); err == nil {
+		t.Fatal("an invalid resolution should be rejected")
+	}
+}
+
+func Test_CVVDPDisplayModels_RoundTrip(t *testing.T) {
+	f, err := vship.ParseCVVDPDisplayModels([]byte(upstreamDisplayModels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "display_models.json")
+	if err := f.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	again, err := vship.LoadCVVDPDisplayModelsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(f.Models, again.Models) {
+		t.Fatalf("models changed in the round trip:\n%+v\n%+v", f.Models,
+			again.Models)
+	}
+
+	var before, after map[string]map[string]any
+	data, err := again.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(upstreamDisplayModels),
+		&before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &after); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("JSON changed in the round trip:\n%v\n%v", before, after)
+	}
+}
+
+func Test_CVVDPDisplayModels_Fractional(t *testing.T) {
+	f, err := vship.ParseCVVDPDisplayModels([]byte(
+		`{"dim": {"contrast": 1500.5, "E_ambient": 0.5}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := f.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if dim := out["dim"]; dim["contrast"] != 1500.5 ||
+		dim["E_ambient"] != 0.5 {
+		t.Fatalf("dim = %v, want the fractional values kept", dim)
+	}
+
+	// Edited values replace the original ones.
+	dim := f.Models["dim"]
+	dim.AmbientLightLevel = 10
+	f.Models["dim"] = dim
+	if data, err = f.MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if d := out["dim"]; d["E_ambient"] != 10.0 || d["contrast"] != 1500.5 {
+		t.Fatalf("dim = %v after editing E_ambient", d)
+	}
+}
+
+func Test_CVVDPDisplayModels_Edit(t *testing.T) {
+	f, err := vship.ParseCVVDPDisplayModels([]byte(upstreamDisplayModels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vive := f.Models["htc_vive_pro"]
+	vive.DisplayMaxLuminance = 0
+	vive.Exposure = 2
+	f.Models["htc_vive_pro"] = vive
+	f.Models["phone"] = vship.DisplayModel{Name: "phone",
+		DisplayWidth: 1080, DisplayHeight: 2400}
+	delete(f.Models, "standard_4k")
+
+	data, err := f.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := out["standard_4k"]; ok {
+		t.Fatal("deleted model was written")
+	}
+	got := out["htc_vive_pro"]
+	if got["max_luminance"] != 0.0 || got["exposure"] != 2.0 ||
+		got["fov_diagonal"] != 110.0 {
+		t.Fatalf("htc_vive_pro = %v", got)
+	}
+	phone := out["phone"]
+	if phone["source"] != "none" || len(phone) != 3 {
+		t.Fatalf("phone = %v, want name, resolution and source", phone)
+	}
+}
@@ -1,6 +1,7 @@
 package govship_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -35,3 +36,98 @@ func Test_DisplayModelsToCVVDPJSON_Print(t *testing.T) {
 
 	fmt.Println(string(jsonBytes))
 }
+
+func Test_DisplayModelsToCVVDPJSON_Zero(t *testing.T) {
+	data, err := vship.DisplayModelsToCVVDPJSON([]vship.DisplayModel{
+		vship.DisplayModelPresetStandardHDRDarkRoom, {Name: "unnamed"}, {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	dark, ok := out["standard_hdr_dark"]
+	if !ok {
+		t.Fatalf("preset not written under its key: %v", out)
+	}
+	if ambient, ok := dark["E_ambient"]; !ok || ambient != 0.0 {
+		t.Fatalf("E_ambient = %v, %v, want an explicit 0", ambient, ok)
+	}
+	unnamed, ok := out["unnamed"]
+	if !ok {
+		t.Fatal("model without a key should fall back to its name")
+	}
+	// An exposure of zero would make every frame black, so it is left to
+	// CVVDP's default.
+	if exposure, ok := unnamed["exposure"]; ok {
+		t.Fatalf("exposure = %v, want it left out", exposure)
+	}
+	if dark["exposure"] != 1.0 {
+		t.Fatalf("exposure = %v, want 1", dark["exposure"])
+	}
+	if _, ok := out["display-2"]; !ok {
+		t.Fatal("model without a key or name should fall back to its index")
+	}
+
+	if _, err := vship.DisplayModelsToCVVDPJSON([]vship.DisplayModel{
+		vship.DisplayModelPresetStandardFHD,
+		vship.DisplayModelPresetStandardFHD}); err == nil {
+		t.Fatal("duplicate keys should be rejected")
+	}
+}
+
+func Test_DisplayModelOverridesToCVVDPJSON(t *testing.T) {
+	data, err := vship.DisplayModelOverridesToCVVDPJSON(
+		[]vship.DisplayModelOverride{{
+			Key:               "standard_fhd",
+			ColorSpace:        vship.Ptr(vship.DisplayModelColorspaceHDR),
+			AmbientLightLevel: vship.Ptr(0),
+		}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	fhd := out["standard_fhd"]
+	if len(fhd) != 2 || fhd["colorspace"] != "HDR" || fhd["E_ambient"] != 0.0 {
+		t.Fatalf("standard_fhd = %v, want colorspace and E_ambient only", fhd)
+	}
+
+	for _, bad := range []vship.DisplayModelOverride{
+		{Exposure: vship.Ptr[float32](1)},
+		{Key: "half", DisplayWidth: vship.Ptr(1920)},
+	} {
+		if _, err := vship.DisplayModelOverridesToCVVDPJSON(
+			[]vship.DisplayModelOverride{bad}); err == nil {
+			t.Fatalf("%+v should be rejected", bad)
+		}
+	}
+}
+
+func Test_DisplayModelOverride_Apply(t *testing.T) {
+	base := vship.DisplayModelPresetStandard4K
+	got := vship.DisplayModelOverride{
+		Key:                 "ignored",
+		DisplayMaxLuminance: vship.Ptr[float32](400),
+		AmbientLightLevel:   vship.Ptr(0),
+	}.Apply(base)
+
+	want := base
+	want.DisplayMaxLuminance, want.AmbientLightLevel = 400, 0
+	if got != want {
+		t.Fatalf("Apply = %+v, want %+v", got, want)
+	}
+	if base.Override().Apply(vship.DisplayModel{Key: base.Key}) != base {
+		t.Fatal("a full override should reproduce the model")
+	}
+
+	named := vship.DisplayModel{Name: "desk", DisplayWidth: 1920,
+		DisplayHeight: 1080}
+	if o := named.Override(); o.Key != "desk" || o.Exposure != nil {
+		t.Fatalf("override of %+v = %+v", named, o)
+	}
+}
@@ -0,0 +1,192 @@
+package govship
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Presets for viewing conditions beyond CVVDP's reference monitors. Each
+// states its assumptions in Name; their keys are not CVVDP built-in keys, so
+// they must be passed to NewCVVDPHandlerWithConfig in a configuration
+// produced by DisplayModelsToCVVDPJSON.
+var (
+	// DisplayModelPresetSmartphone models a 6.1-inch OLED phone held in
+	// landscape at 30 cm indoors, about 94 pixels per degree.
+	DisplayModelPresetSmartphone = DisplayModel{
+		Key: "smartphone_30cm",
+		Name: "6.1-inch OLED smartphone in landscape, peak luminance 600 " +
+			"cd/m^2, viewed under office light levels (250 lux) from 30 cm",
+		ColorSpace:                      DisplayModelColorspaceSDR,
+		DisplayWidth:                    2532,
+		DisplayHeight:                   1170,
+		DisplayMaxLuminance:             600,
+		DisplayDiagonalSizeInches:       6.1,
+		ViewingDistanceMeters:           0.3,
+		MonitorContrastRatio:            1000000,
+		AmbientLightLevel:               250,
+		AmbientLightReflectionOnDisplay: 0.005,
+		Exposure:                        1,
+	}
+
+	// DisplayModelPresetTablet models an 11-inch LCD tablet held at 40 cm,
+	// 2.5 display heights.
+	DisplayModelPresetTablet = DisplayModel{
+		Key: "tablet_40cm",
+		Name: "11-inch LCD tablet in landscape, peak luminance 500 cd/m^2, " +
+			"viewed under office light levels (250 lux) from 40 cm",
+		ColorSpace:                      DisplayModelColorspaceSDR,
+		DisplayWidth:                    2388,
+		DisplayHeight:                   1668,
+		DisplayMaxLuminance:             500,
+		DisplayDiagonalSizeInches:       11,
+		ViewingDistanceMeters:           0.4,
+		MonitorContrastRatio:            1500,
+		AmbientLightLevel:               250,
+		AmbientLightReflectionOnDisplay: 0.005,
+		Exposure:                        1,
+	}
+
+	// DisplayModelPresetLaptop13 models a 13.3-inch 16:10 laptop on a desk at
+	// 50 cm.
+	DisplayModelPresetLaptop13 = DisplayModel{
+		Key: "laptop_13in",
+		Name: "13.3-inch 2560x1600 laptop, peak luminance 400 cd/m^2, " +
+			"viewed under office light levels (250 lux) from 50 cm",
+		ColorSpace:                      DisplayModelColorspaceSDR,
+		DisplayWidth:                    2560,
+		DisplayHeight:                   1600,
+		DisplayMaxLuminance:             400,
+		DisplayDiagonalSizeInches:       13.3,
+		ViewingDistanceMeters:           0.5,
+		MonitorContrastRatio:            1200,
+		AmbientLightLevel:               250,
+		AmbientLightReflectionOnDisplay: 0.005,
+		Exposure:                        1,
+	}
+
+	// DisplayModelPresetTV65 models a 65-inch 4K LCD television in a lit
+	// living room, seen from a sofa 2.5 m away, about 3 display heights.
+	DisplayModelPresetTV65 = DisplayModel{
+		Key: "tv_65in_4k",
+		Name: "65-inch 4K LCD TV, peak luminance 350 cd/m^2, viewed in a " +
+			"living room (100 lux) from 2.5 m",
+		ColorSpace:                      DisplayModelColorspaceSDR,
+		DisplayWidth:                    3840,
+		DisplayHeight:                   2160,
+		DisplayMaxLuminance:             350,
+		DisplayDiagonalSizeInches:       65,
+		ViewingDistanceMeters:           2.5,
+		MonitorContrastRatio:            5000,
+		AmbientLightLevel:               100,
+		AmbientLightReflectionOnDisplay: 0.005,
+		Exposure:                        1,
+	}
+
+	// DisplayModelPresetOLEDTVDarkRoom models a 65-inch 4K OLED television
+	// showing HDR content in a dark home theater.
+	DisplayModelPresetOLEDTVDarkRoom = DisplayModel{
+		Key: "tv_65in_oled_hdr_dark",
+		Name: "65-inch 4K OLED HDR TV, peak luminance 800 cd/m^2, viewed in " +
+			"a dark room (0 lux) from 2.5 m",
+		ColorSpace:                      DisplayModelColorspaceHDR,
+		DisplayWidth:                    3840,
+		DisplayHeight:                   2160,
+		DisplayMaxLuminance:             800,
+		DisplayDiagonalSizeInches:       65,
+		ViewingDistanceMeters:           2.5,
+		MonitorContrastRatio:            1000000,
+		AmbientLightLevel:               0,
+		AmbientLightReflectionOnDisplay: 0.005,
+		Exposure:                        1,
+	}
+
+	// DisplayModelPresetVRHeadset models one eye of an LCD VR headset with a
+	// 100° diagonal field of view. The display model has no field of view,
+	// so the lens is described as a virtual screen 1 m away whose diagonal
+	// covers the same angle.
+	DisplayModelPresetVRHeadset = DisplayModel{
+		Key: "vr_headset",
+		Name: "LCD VR headset, 1832x1920 per eye, 100 degree diagonal field " +
+			"of view, peak luminance 100 cd/m^2, no ambient light",
+		ColorSpace:                      DisplayModelColorspaceSDR,
+		DisplayWidth:                    1832,
+		DisplayHeight:                   1920,
+		DisplayMaxLuminance:             100,
+		DisplayDiagonalSizeInches:       93.84,
+		ViewingDistanceMeters:           1,
+		MonitorContrastRatio:            1000,
+		AmbientLightLevel:               0,
+		AmbientLightReflectionOnDisplay: 0,
+		Exposure:                        1,
+	}
+)
+
+var (
+	displayPresetsMu sync.RWMutex
+	// displayPresets holds the registered presets by key.
+	displayPresets = map[string]DisplayModel{}
+)
+
+func init() {
+	for _, m := range []DisplayModel{
+		DisplayModelPresetStandard4K,
+		DisplayModelPresetStandardFHD,
+		DisplayModelPresetStandardHDR,
+		DisplayModelPresetStandardHDRDarkRoom,
+		DisplayModelPresetSmartphone,
+		DisplayModelPresetTablet,
+		DisplayModelPresetLaptop13,
+		DisplayModelPresetTV65,
+		DisplayModelPresetOLEDTVDarkRoom,
+		DisplayModelPresetVRHeadset,
+	} {
+		if err := RegisterDisplayModelPreset(m); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// LookupDisplayModelPreset returns the preset registered under key.
+//
+// The presets of CVVDP's reference monitors are registered under CVVDP's own
+// keys ("standard_4k", "standard_fhd", "standard_hdr_pq" and
+// "standard_hdr_dark"), so the key alone can be passed to NewCVVDPHandler.
+// Any preset can be passed to NewCVVDPHandlerWithConfig with its key and the
+// output of DisplayModelsToCVVDPJSON.
+func LookupDisplayModelPreset(key string) (DisplayModel, bool) {
+	displayPresetsMu.RLock()
+	defer displayPresetsMu.RUnlock()
+	m, ok := displayPresets[key]
+	return m, ok
+}
+
+// DisplayModelPresetKeys returns the keys of the registered presets, sorted.
+func DisplayModelPresetKeys() []string {
+	displayPresetsMu.RLock()
+	defer displayPresetsMu.RUnlock()
+	return slices.Sorted(maps.Keys(displayPresets))
+}
+
+// RegisterDisplayModelPreset adds m to the presets under m.Key, for example
+// a calibrated monitor of a test lab. The key must not be taken and the
+// model must pass Validate.
+func RegisterDisplayModelPreset(m DisplayModel) error {
+	if m.Key == "" {
+		return errors.New("display model preset without a key")
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	displayPresetsMu.Lock()
+	defer displayPresetsMu.Unlock()
+	if _, ok := displayPresets[m.Key]; ok {
+		return fmt.Errorf("display model preset %q already registered",
+			m.Key)
+	}
+	displayPresets[m.Key] = m
+	return nil
+}
@@ -0,0 +1,77 @@
+package govship_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_DisplayModelPresets(t *testing.T) {
+	keys := vship.DisplayModelPresetKeys()
+	for _, key := range []string{"standard_4k", "standard_fhd",
+		"standard_hdr_pq", "standard_hdr_dark", "smartphone_30cm",
+		"tv_65in_4k", "vr_headset"} {
+		if !slices.Contains(keys, key) {
+			t.Fatalf("preset %q missing from %v", key, keys)
+		}
+	}
+
+	names := map[string]string{}
+	for _, key := range keys {
+		m, ok := vship.LookupDisplayModelPreset(key)
+		if !ok || m.Key != key {
+			t.Fatalf("lookup of %q returned %+v, %v", key, m, ok)
+		}
+		if other, ok := names[m.Name]; ok {
+			t.Fatalf("%q and %q share a description", key, other)
+		}
+		names[m.Name] = key
+	}
+
+	// The FHD reference monitor is seen from 2 display heights like the 4K
+	// one.
+	fhd := vship.DisplayModelPresetStandardFHD
+	if d := fhd.ViewingDistanceInHeights(); !near(d, 2, 1e-3) {
+		t.Fatalf("standard_fhd is seen from %v heights", d)
+	}
+	vr := vship.DisplayModelPresetVRHeadset
+	if !near(vr.DisplayWidthMeters()*vr.DisplayWidthMeters()+
+		vr.DisplayHeightMeters()*vr.DisplayHeightMeters(),
+		2.3835*2.3835, 1e-2) {
+		t.Fatal("VR virtual screen does not span 100 degrees diagonally")
+	}
+
+	tv := vship.DisplayModelPresetTV65
+	data, err := vship.DisplayModelsToCVVDPJSON([]vship.DisplayModel{tv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config[tv.Key]; !ok {
+		t.Fatalf("config lacks %q: %s", tv.Key, data)
+	}
+}
+
+func Test_RegisterDisplayModelPreset(t *testing.T) {
+	m := vship.DisplayModelPresetStandard4K
+	if err := vship.RegisterDisplayModelPreset(m); err == nil {
+		t.Fatal("duplicate key accepted")
+	}
+	m.Key = "test_lab_monitor_1"
+	m.MonitorContrastRatio = 0
+	if err := vship.RegisterDisplayModelPreset(m); err == nil {
+		t.Fatal("invalid model accepted")
+	}
+	m.MonitorContrastRatio = 1300
+	if err := vship.RegisterDisplayModelPreset(m); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := vship.LookupDisplayModelPreset(m.Key); !ok || got != m {
+		t.Fatalf("lookup = %+v, %v", got, ok)
+	}
+}
@@ -0,0 +1,234 @@
+package govship
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"unsafe"
+)
+
+// PoolingMethod selects how a group of per-pixel distortion values is reduced
+// to a single number.
+type PoolingMethod int
+
+const (
+	// PoolingMean averages all values.
+	PoolingMean PoolingMethod = iota
+	// PoolingMax keeps the single worst value.
+	PoolingMax
+	// PoolingNorm2 computes the 2-norm (root mean square) of all values.
+	PoolingNorm2
+	// PoolingNorm3 computes the 3-norm of all values. This matches the
+	// emphasis of ButteraugliScore.Norm3.
+	PoolingNorm3
+)
+
+// DistortionMap holds a per-pixel distortion map produced by a metric.
+//
+// Values are stored row major with no padding, so the value of pixel (x, y)
+// is Data[y*Width+x]. The meaning and scale of the values depend on the
+// metric that produced the map. For Butteraugli every value is the distance
+// of that pixel; for CVVDP it is the per-pixel difference of the last scored
+// frame.
+type DistortionMap struct {
+	Width, Height int
+	Data          []float32
+}
+
+// NewDistortionMap allocates a zeroed DistortionMap of the given size.
+func NewDistortionMap(width, height int) *DistortionMap {
+	return &DistortionMap{width, height, make([]float32, width*height)}
+}
+
+// DistortionMapFromBytes copies a raw float32 distortion map, as written by
+// the dst buffer of ButteraugliHandler.ComputeScore or
+// CVVDPHandler.ComputeScore, into a DistortionMap.
+//
+// stride is the number of bytes between the start of two consecutive rows
+// and must be at least width * 4. data must hold at least height rows.
+func DistortionMapFromBytes(data []byte, stride int64, width,
+	height int) (*DistortionMap, error) {
+	rowBytes := int64(width) * 4
+	if stride < rowBytes {
+		return nil, fmt.Errorf("stride %d is smaller than a row of %d bytes",
+			stride, rowBytes)
+	}
+	if height > 0 && int64(len(data)) < stride*int64(height-1)+rowBytes {
+		return nil, fmt.Errorf("buffer of %d bytes too small for %dx%d map",
+			len(data), width, height)
+	}
+
+	m := NewDistortionMap(width, height)
+	for y := range height {
+		row := data[int64(y)*stride:]
+		for x := range width {
+			m.Data[y*width+x] = math.Float32frombits(
+				binary.NativeEndian.Uint32(row[x*4:]))
+		}
+	}
+	return m, nil
+}
+
+// bytes exposes the map storage as a byte slice so it can be handed directly
+// to libvship as a dst buffer with a stride of Width * 4.
+func (m *DistortionMap) bytes() []byte {
+	if len(m.Data) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(&m.Data[0])), len(m.Data)*4)
+}
+
+// stride returns the row size of the map in bytes.
+func (m *DistortionMap) stride() int64 { return int64(m.Width) * 4 }
+
+// At returns the value of pixel (x, y).
+func (m *DistortionMap) At(x, y int) float32 { return m.Data[y*m.Width+x] }
+
+// Mean returns the average value of the map.
+func (m *DistortionMap) Mean() float64 {
+	if len(m.Data) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range m.Data {
+		sum += float64(v)
+	}
+	return sum / float64(len(m.Data))
+}
+
+// PNorm returns the p-norm of the map, (mean(|v|^p))^(1/p).
+//
+// Larger values of p move the result toward the worst pixel; p = 1 is the
+// mean absolute value. A p of +Inf returns the maximum absolute value.
+func (m *DistortionMap) PNorm(p float64) float64 {
+	return pnorm(m.Data, p)
+}
+
+// Max returns the largest value in the map along with its location. If there
+// are several pixels with the same value the first one in row major order is
+// returned.
+func (m *DistortionMap) Max() (value float32, x, y int) {
+	if len(m.Data) == 0 {
+		return 0, 0, 0
+	}
+	idx := 0
+	for i, v := range m.Data {
+		if v > m.Data[idx] {
+			idx = i
+		}
+	}
+	return m.Data[idx], idx % m.Width, idx / m.Width
+}
+
+// Percentile returns the p-th percentile (0 to 100) of the map values using
+// linear interpolation between the closest ranks.
+func (m *DistortionMap) Percentile(p float64) float64 {
+	return m.Percentiles(p)[0]
+}
+
+// Percentiles returns several percentiles (0 to 100) of the map values while
+// only sorting the map once.
+func (m *DistortionMap) Percentiles(ps ...float64) []float64 {
+	sorted := slices.Clone(m.Data)
+	slices.Sort(sorted)
+
+	out := make([]float64, len(ps))
+	for i, p := range ps {
+		out[i] = sortedPercentile(sorted, p)
+	}
+	return out
+}
+
+// AreaAbove returns the fraction of pixels, between 0 and 1, whose value is
+// strictly greater than threshold. For Butteraugli a threshold of 1 gives the
+// share of the frame with a visible difference at the reference distance.
+func (m *DistortionMap) AreaAbove(threshold float32) float64 {
+	if len(m.Data) == 0 {
+		return 0
+	}
+	var count int
+	for _, v := range m.Data {
+		if v > threshold {
+			count++
+		}
+	}
+	return float64(count) / float64(len(m.Data))
+}
+
+// Tiles splits the map into a cols x rows grid and pools every tile with the
+// given method. The result is a DistortionMap of size cols x rows where each
+// value summarizes the matching region of the source map, which makes it easy
+// to locate where in the frame artefacts are concentrated.
+//
+// When the map size is not divisible by the grid, tile edges are rounded so
+// every pixel belongs to exactly one tile.
+func (m *DistortionMap) Tiles(cols, rows int, method PoolingMethod,
+) *DistortionMap {
+	out := NewDistortionMap(cols, rows)
+	tile := make([]float32, 0, (m.Width/max(cols, 1)+1)*
+		(m.Height/max(rows, 1)+1))
+
+	for ty := range rows {
+		y0, y1 := ty*m.Height/rows, (ty+1)*m.Height/rows
+		for tx := range cols {
+			x0, x1 := tx*m.Width/cols, (tx+1)*m.Width/cols
+
+			tile = tile[:0]
+			for y := y0; y < y1; y++ {
+				tile = append(tile, m.Data[y*m.Width+x0:y*m.Width+x1]...)
+			}
+			out.Data[ty*cols+tx] = float32(pool(tile, method))
+		}
+	}
+	return out
+}
+
+// pool reduces values with the given PoolingMethod.
+func pool(values []float32, method PoolingMethod) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	switch method {
+	case PoolingMax:
+		return float64(slices.Max(values))
+	case PoolingNorm2:
+		return pnorm(values, 2)
+	case PoolingNorm3:
+		return pnorm(values, 3)
+	default:
+		return pnorm(values, 1)
+	}
+}
+
+func pnorm(values []float32, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	if math.IsInf(p, 1) {
+		var m float64
+		for _, v := range values {
+			m = max(m, math.Abs(float64(v)))
+		}
+		return m
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += math.Pow(math.Abs(float64(v)), p)
+	}
+	return math.Pow(sum/float64(len(values)), 1/p)
+}
+
+// sortedPercentile returns the p-th percentile of already sorted values.
+func sortedPercentile[T float32 | float64](sorted []T, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	p = min(max(p, 0), 100)
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	frac := rank - float64(lo)
+	return float64(sorted[lo])*(1-frac) + float64(sorted[hi])*frac
+}
@@ -0,0 +1,85 @@
+package govship_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_DistortionMap_Statistics(t *testing.T) {
+	dmap := vship.NewDistortionMap(4, 2)
+	copy(dmap.Data, []float32{0, 1, 2, 3, 4, 5, 6, 7})
+
+	if mean := dmap.Mean(); mean != 3.5 {
+		t.Fatalf("Mean() = %f, want 3.5", mean)
+	}
+
+	value, x, y := dmap.Max()
+	if value != 7 || x != 3 || y != 1 {
+		t.Fatalf("Max() = %f at (%d, %d), want 7 at (3, 1)", value, x, y)
+	}
+
+	ps := dmap.Percentiles(0, 50, 100)
+	if ps[0] != 0 || ps[1] != 3.5 || ps[2] != 7 {
+		t.Fatalf("Percentiles(0, 50, 100) = %v", ps)
+	}
+
+	if area := dmap.AreaAbove(5); area != 0.25 {
+		t.Fatalf("AreaAbove(5) = %f, want 0.25", area)
+	}
+
+	if norm := dmap.PNorm(math.Inf(1)); norm != 7 {
+		t.Fatalf("PNorm(Inf) = %f, want 7", norm)
+	}
+
+	want := math.Sqrt((0 + 1 + 4 + 9 + 16 + 25 + 36 + 49) / 8.0)
+	if norm := dmap.PNorm(2); math.Abs(norm-want) > 1e-9 {
+		t.Fatalf("PNorm(2) = %f, want %f", norm, want)
+	}
+}
+
+func Test_DistortionMap_Tiles(t *testing.T) {
+	dmap := vship.NewDistortionMap(4, 2)
+	copy(dmap.Data, []float32{0, 1, 2, 3, 4, 5, 6, 7})
+
+	tiles := dmap.Tiles(2, 1, vship.PoolingMean)
+	if tiles.Width != 2 || tiles.Height != 1 {
+		t.Fatalf("Tiles size = %dx%d, want 2x1", tiles.Width, tiles.Height)
+	}
+	if tiles.Data[0] != 2.5 || tiles.Data[1] != 4.5 {
+		t.Fatalf("mean tiles = %v, want [2.5 4.5]", tiles.Data)
+	}
+
+	tiles = dmap.Tiles(2, 2, vship.PoolingMax)
+	want := []float32{1, 3, 5, 7}
+	for i := range want {
+		if tiles.Data[i] != want[i] {
+			t.Fatalf("max tiles = %v, want %v", tiles.Data, want)
+		}
+	}
+}
+
+func Test_DistortionMapFromBytes(t *testing.T) {
+	const width, height, stride = 2, 2, 12
+	data := make([]byte, stride*height)
+	for y := range height {
+		for x := range width {
+			binary.NativeEndian.PutUint32(data[y*stride+x*4:],
+				math.Float32bits(float32(y*width+x)))
+		}
+	}
+
+	dmap, err := vship.DistortionMapFromBytes(data, stride, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dmap.At(1, 1) != 3 || dmap.At(0, 1) != 2 {
+		t.Fatalf("unexpected map contents %v", dmap.Data)
+	}
+
+	if _, err := vship.DistortionMapFromBytes(data, 4, width, height); err == nil {
+		t.Fatal("expected an error for a stride smaller than a row")
+	}
+}
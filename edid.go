@@ -0,0 +1,206 @@
+package govship
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// edidBlockSize is the size of the EDID base block and of every extension.
+const edidBlockSize = 128
+
+var edidHeader = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+// EDID holds the properties of a monitor relevant to its display model, read
+// from its Extended Display Identification Data.
+type EDID struct {
+	// Manufacturer is the three letter PNP ID, e.g. "DEL".
+	Manufacturer string
+	ProductCode  uint16
+	// Name is the monitor name descriptor, empty if absent.
+	Name string
+	// Resolution of the preferred timing, zero if the EDID has none.
+	Width, Height int
+	// Physical size of the image area in millimeters, zero if unknown, as
+	// for projectors.
+	WidthMM, HeightMM int
+	// HDR is the HDR Static Metadata Data Block of a CTA-861 extension, nil
+	// if the monitor does not declare one.
+	HDR *EDIDHDRMetadata
+}
+
+// EDIDHDRMetadata holds the HDR Static Metadata Data Block of CTA-861.
+type EDIDHDRMetadata struct {
+	// Transfer functions the monitor accepts.
+	SDR, HDR, PQ, HLG bool
+	// Desired content luminance in cd/m², zero when not given.
+	MaxLuminance, MaxFrameAverageLuminance, MinLuminance float64
+}
+
+// ParseEDID parses a raw EDID blob: the base block followed by its
+// extensions. Extensions other than CTA-861 are skipped. Checksums are
+// verified.
+func ParseEDID(data []byte) (*EDID, error) {
+	if len(data) < edidBlockSize || !bytes.HasPrefix(data, edidHeader) {
+		return nil, errors.New("not an EDID blob")
+	}
+	if err := edidChecksum(data[:edidBlockSize], 0); err != nil {
+		return nil, err
+	}
+
+	base := data[:edidBlockSize]
+	id := uint16(base[8])<<8 | uint16(base[9])
+	e := &EDID{
+		Manufacturer: string([]byte{byte(id>>10&0x1f) + '@',
+			byte(id>>5&0x1f) + '@', byte(id&0x1f) + '@'}),
+		ProductCode: uint16(base[10]) | uint16(base[11])<<8,
+	}
+	// The size in centimeters is superseded by the preferred timing; when
+	// one of the two is zero they encode an aspect ratio instead.
+	if base[21] != 0 && base[22] != 0 {
+		e.WidthMM, e.HeightMM = int(base[21])*10, int(base[22])*10
+	}
+	for i := 54; i < 126; i += 18 {
+		e.parseDescriptor(base[i:i+18], i == 54)
+	}
+
+	extensions := int(base[126])
+	if len(data) < edidBlockSize*(1+extensions) {
+		return nil, fmt.Errorf("EDID has %d of %d extension blocks",
+			len(data)/edidBlockSize-1, extensions)
+	}
+	for n := 1; n <= extensions; n++ {
+		block := data[n*edidBlockSize : (n+1)*edidBlockSize]
+		if err := edidChecksum(block, n); err != nil {
+			return nil, err
+		}
+		if block[0] == 0x02 {
+			e.parseCTA(block)
+		}
+	}
+	return e, nil
+}
+
+// LoadEDIDFile parses an EDID from a file holding either the raw blob, as
+// found in /sys/class/drm/*/edid, or a hex dump of it.
+func LoadEDIDFile(path string) (*EDID, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, edidHeader) {
+		digits := strings.Join(strings.Fields(string(data)), "")
+		if decoded, err := hex.DecodeString(digits); err == nil {
+			data = decoded
+		}
+	}
+	e, err := ParseEDID(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// edidChecksum verifies that the bytes of a block sum to zero.
+func edidChecksum(block []byte, index int) error {
+	var sum byte
+	for _, b := range block {
+		sum += b
+	}
+	if sum != 0 {
+		return fmt.Errorf("EDID block %d has an invalid checksum", index)
+	}
+	return nil
+}
+
+// parseDescriptor reads an 18 byte descriptor: a detailed timing, of which
+// the first is the preferred one, or a display descriptor.
+func (e *EDID) parseDescriptor(d []byte, preferred bool) {
+	if d[0] != 0 || d[1] != 0 {
+		if !preferred {
+			return
+		}
+		e.Width = int(d[2]) | int(d[4]&0xf0)<<4
+		e.Height = int(d[5]) | int(d[7]&0xf0)<<4
+		widthMM := int(d[12]) | int(d[14]&0xf0)<<4
+		heightMM := int(d[13]) | int(d[14]&0x0f)<<8
+		if widthMM > 0 && heightMM > 0 {
+			e.WidthMM, e.HeightMM = widthMM, heightMM
+		}
+		return
+	}
+	if d[3] == 0xfc {
+		name, _, _ := bytes.Cut(d[5:], []byte{0x0a})
+		e.Name = strings.TrimSpace(string(name))
+	}
+}
+
+// parseCTA reads the data block collection of a CTA-861 extension looking
+// for the HDR Static Metadata Data Block.
+func (e *EDID) parseCTA(block []byte) {
+	end := min(int(block[2]), edidBlockSize-1)
+	for i := 4; i < end; {
+		tag, length := block[i]>>5, int(block[i]&0x1f)
+		payload := block[i+1 : min(i+1+length, end)]
+		i += 1 + length
+		// Extended tag 6 is the HDR Static Metadata Data Block.
+		if tag != 7 || len(payload) < 3 || payload[0] != 6 {
+			continue
+		}
+
+		eotf := payload[1]
+		hdr := &EDIDHDRMetadata{SDR: eotf&1 != 0, HDR: eotf&2 != 0,
+			PQ: eotf&4 != 0, HLG: eotf&8 != 0}
+		// Luminances are coded as 50·2^(CV/32), the minimum relative to
+		// the maximum as max·(CV/255)²/100.
+		if len(payload) > 3 && payload[3] != 0 {
+			hdr.MaxLuminance = 50 * math.Exp2(float64(payload[3])/32)
+		}
+		if len(payload) > 4 && payload[4] != 0 {
+			hdr.MaxFrameAverageLuminance = 50 *
+				math.Exp2(float64(payload[4])/32)
+		}
+		if len(payload) > 5 {
+			cv := float64(payload[5]) / 255
+			hdr.MinLuminance = hdr.MaxLuminance * cv * cv / 100
+		}
+		e.HDR = hdr
+	}
+}
+
+// DisplayModel returns base with the properties the EDID describes
+// replaced: the name, resolution, diagonal and, if the monitor declares HDR
+// static metadata, the colorspace, peak luminance and contrast. Viewing
+// conditions and anything the EDID lacks are kept from base, so start from a
+// preset such as DisplayModelPresetStandard4K and set the viewing distance
+// afterwards, e.g. with ViewingDistanceFromHeights.
+func (e *EDID) DisplayModel(base DisplayModel) DisplayModel {
+	m := base
+	m.Name = strings.TrimSpace(e.Manufacturer + " " + e.Name)
+	if e.Width > 0 && e.Height > 0 {
+		m.DisplayWidth, m.DisplayHeight = e.Width, e.Height
+	}
+	if e.WidthMM > 0 && e.HeightMM > 0 {
+		m.DisplayDiagonalSizeInches = float32(math.Hypot(
+			float64(e.WidthMM), float64(e.HeightMM)) / 25.4)
+	}
+
+	if e.HDR == nil {
+		return m
+	}
+	if e.HDR.PQ || e.HDR.HLG {
+		m.ColorSpace = DisplayModelColorspaceHDR
+	}
+	if e.HDR.MaxLuminance > 0 {
+		m.DisplayMaxLuminance = float32(e.HDR.MaxLuminance)
+		if e.HDR.MinLuminance > 0 {
+			m.MonitorContrastRatio = int(math.Round(
+				e.HDR.MaxLuminance / e.HDR.MinLuminance))
+		}
+	}
+	return m
+}
@@ -0,0 +1,116 @@
+package govship_test
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// testEDID builds a 4K HDR monitor EDID with a CTA-861 extension.
+func testEDID() []byte {
+	data := make([]byte, 256)
+	base, cta := data[:128], data[128:]
+
+	copy(base, []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00})
+	base[8], base[9] = 0x10, 0xac // DEL
+	base[10], base[11] = 0x34, 0x12
+	base[21], base[22] = 60, 34
+
+	// Preferred timing: 3840x2160, 597x336 mm.
+	dtd := base[54:72]
+	dtd[0], dtd[1] = 0x08, 0xe8
+	dtd[2], dtd[4] = 0x00, 0xf0
+	dtd[5], dtd[7] = 0x70, 0x80
+	dtd[12], dtd[13], dtd[14] = 0x55, 0x50, 0x21
+	// Monitor name descriptor.
+	name := base[72:90]
+	name[3] = 0xfc
+	copy(name[5:], "U2723QE\n     ")
+	base[126] = 1
+
+	cta[0], cta[1], cta[2] = 0x02, 0x03, 0x0b
+	// HDR static metadata: SDR and PQ, 604 cd/m² peak, 10404:1.
+	copy(cta[4:], []byte{7<<5 | 6, 6, 0x05, 0x01, 115, 100, 25})
+
+	for _, block := range [][]byte{base, cta} {
+		var sum byte
+		for _, b := range block[:127] {
+			sum += b
+		}
+		block[127] = -sum
+	}
+	return data
+}
+
+func Test_ParseEDID(t *testing.T) {
+	e, err := vship.ParseEDID(testEDID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Manufacturer != "DEL" || e.ProductCode != 0x1234 ||
+		e.Name != "U2723QE" || e.Width != 3840 || e.Height != 2160 ||
+		e.WidthMM != 597 || e.HeightMM != 336 {
+		t.Fatalf("unexpected EDID %+v", e)
+	}
+	if e.HDR == nil || !e.HDR.PQ || e.HDR.HLG || !e.HDR.SDR ||
+		!near(e.HDR.MaxLuminance, 603.7, 0.1) {
+		t.Fatalf("unexpected HDR metadata %+v", e.HDR)
+	}
+
+	corrupt := testEDID()
+	corrupt[200]++
+	if _, err := vship.ParseEDID(corrupt); err == nil {
+		t.Fatal("bad extension checksum accepted")
+	}
+	if _, err := vship.ParseEDID(testEDID()[:128]); err == nil {
+		t.Fatal("missing extension accepted")
+	}
+}
+
+func Test_EDID_DisplayModel(t *testing.T) {
+	e, err := vship.ParseEDID(testEDID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := e.DisplayModel(vship.DisplayModelPresetStandard4K)
+	if m.Name != "DEL U2723QE" || m.DisplayWidth != 3840 ||
+		m.ColorSpace != vship.DisplayModelColorspaceHDR ||
+		m.MonitorContrastRatio != 10404 ||
+		!near(float64(m.DisplayMaxLuminance), 603.7, 0.1) ||
+		!near(float64(m.DisplayDiagonalSizeInches), 26.97, 0.01) {
+		t.Fatalf("unexpected model %+v", m)
+	}
+	if m.AmbientLightLevel != 250 || m.Key != "standard_4k" {
+		t.Fatal("viewing conditions should come from the base model")
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_LoadEDIDFile(t *testing.T) {
+	dir := t.TempDir()
+	raw := filepath.Join(dir, "edid.bin")
+	dump := filepath.Join(dir, "edid.hex")
+	if err := os.WriteFile(raw, testEDID(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text := hex.EncodeToString(testEDID()[:128]) + "\n" +
+		hex.EncodeToString(testEDID()[128:]) + "\n"
+	if err := os.WriteFile(dump, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{raw, dump} {
+		e, err := vship.LoadEDIDFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Name != "U2723QE" {
+			t.Fatalf("%s: name = %q", path, e.Name)
+		}
+	}
+}
@@ -57,3 +57,24 @@ func (e ExceptionCode) GetError() error {
 	C.Vship_GetErrorMessage(C.Vship_Exception(e), cPtr, msgSize)
 	return errors.New(C.GoString(cPtr))
 }
+
+// Exception is a Go error carrying an ExceptionCode.
+//
+// Helpers that combine Vship calls with other work, such as reading frames,
+// report failures as Go errors. When the failure came from Vship the error is
+// an *Exception, so the original code can be recovered with errors.As.
+type Exception struct {
+	Code ExceptionCode
+}
+
+// Error returns the human-readable description of the wrapped code.
+func (e *Exception) Error() string { return e.Code.GetError().Error() }
+
+// Err converts the ExceptionCode into a Go error. It returns nil if the code
+// indicates success and an *Exception wrapping the code otherwise.
+func (e ExceptionCode) Err() error {
+	if e.IsNone() {
+		return nil
+	}
+	return &Exception{e}
+}
@@ -0,0 +1,279 @@
+package govship
+
+// #include <stdlib.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"unsafe"
+)
+
+// FramePoolOptions configures a FramePool.
+type FramePoolOptions struct {
+	// Alignment is the byte alignment of the start and of the rows of every
+	// plane. It must be a power of two. Defaults to 64.
+	Alignment int
+	// CAllocated allocates planes with the C allocator instead of the Go
+	// heap. The memory is invisible to the garbage collector and is only
+	// returned to the system by Trim or Close.
+	//
+	// Vship does not expose page-locked host allocation, so planes are
+	// regular pageable memory either way.
+	CAllocated bool
+	// TrackCallers records the caller of every Acquire, so that Leaks and
+	// Close can report where unreleased frames came from.
+	TrackCallers bool
+}
+
+// FramePoolStats describes the frames of a FramePool.
+type FramePoolStats struct {
+	// Outstanding is the number of acquired frames not yet released.
+	Outstanding int
+	// Idle is the number of released frames waiting to be reused.
+	Idle int
+	// Allocations is the number of frames allocated over the lifetime of the
+	// pool. It stops growing once the pool covers the peak demand.
+	Allocations int
+	// Bytes is the size of the planes of all frames currently held, idle or
+	// outstanding.
+	Bytes int64
+}
+
+// FramePool recycles frame buffers so that reading and scoring loops do not
+// allocate new planes for every frame.
+//
+// Frames are grouped by plane geometry: two Colorspaces whose planes have the
+// same size and stride share frames. Every frame obtained with Acquire must be
+// given back with Release once its planes are no longer referenced. The pool
+// keeps count of frames that are out, which helps to find leaks.
+//
+// A nil *FramePool is valid: Acquire allocates with NewFrame and Release does
+// nothing. FramePool is safe for concurrent use.
+type FramePool struct {
+	opts FramePoolOptions
+
+	mu          sync.Mutex
+	idle        map[frameGeometry][]*pooledFrame
+	outstanding map[*Frame]*pooledFrame
+	allocations int
+	bytes       int64
+	closed      bool
+}
+
+// frameGeometry is the size and stride of the three planes of a frame.
+type frameGeometry struct {
+	rows   [3]int
+	stride [3]int64
+}
+
+// pooledFrame is a frame of the pool together with the allocation backing
+// its planes.
+type pooledFrame struct {
+	frame  *Frame
+	geom   frameGeometry
+	planes [3][]byte
+	bases  [3]unsafe.Pointer // C allocations, if any
+	caller string
+}
+
+// NewFramePool creates an empty FramePool.
+func NewFramePool(opts FramePoolOptions) *FramePool {
+	if opts.Alignment <= 0 {
+		opts.Alignment = 64
+	}
+	return &FramePool{opts: opts,
+		idle:        make(map[frameGeometry][]*pooledFrame),
+		outstanding: make(map[*Frame]*pooledFrame)}
+}
+
+// Acquire returns a frame large enough to hold one image in the given
+// Colorspace. The frame is reused from a previous Release when possible, in
+// which case its planes still hold the old image.
+func (p *FramePool) Acquire(cs *Colorspace) *Frame {
+	if p == nil {
+		return NewFrame(cs)
+	}
+
+	geom := p.geometry(cs)
+	var caller string
+	if p.opts.TrackCallers {
+		if _, file, line, ok := runtime.Caller(1); ok {
+			caller = fmt.Sprintf("%s:%d", file, line)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var pf *pooledFrame
+	if free := p.idle[geom]; len(free) > 0 {
+		pf = free[len(free)-1]
+		p.idle[geom] = free[:len(free)-1]
+	} else {
+		pf = p.allocate(geom)
+	}
+	pf.caller = caller
+	p.outstanding[pf.frame] = pf
+	return pf.frame
+}
+
+// Release returns a frame obtained from Acquire to the pool. The frame must
+// not be used afterwards. Releasing a frame twice, or a frame that does not
+// come from this pool, returns an error.
+//
+// If the planes of the frame were replaced while it was out, the original
+// planes are put back.
+func (p *FramePool) Release(frame *Frame) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pf, ok := p.outstanding[frame]
+	if !ok {
+		return errors.New("frame was not acquired from this pool or was " +
+			"already released")
+	}
+	delete(p.outstanding, frame)
+	frame.Planes, frame.LineSize = pf.planes, pf.geom.stride
+	pf.caller = ""
+	if p.closed {
+		p.free(pf)
+		return nil
+	}
+	p.idle[pf.geom] = append(p.idle[pf.geom], pf)
+	return nil
+}
+
+// Stats returns the current frame counts of the pool.
+func (p *FramePool) Stats() FramePoolStats {
+	if p == nil {
+		return FramePoolStats{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := FramePoolStats{Outstanding: len(p.outstanding),
+		Allocations: p.allocations, Bytes: p.bytes}
+	for _, free := range p.idle {
+		stats.Idle += len(free)
+	}
+	return stats
+}
+
+// Leaks describes every frame acquired and not yet released, with the
+// location of the Acquire call when TrackCallers is set.
+func (p *FramePool) Leaks() []string {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var leaks []string
+	for _, pf := range p.outstanding {
+		desc := fmt.Sprintf("frame of %d bytes", pf.size())
+		if pf.caller != "" {
+			desc += " acquired at " + pf.caller
+		}
+		leaks = append(leaks, desc)
+	}
+	slices.Sort(leaks)
+	return leaks
+}
+
+// Trim frees every idle frame.
+func (p *FramePool) Trim() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for geom, free := range p.idle {
+		for _, pf := range free {
+			p.free(pf)
+		}
+		delete(p.idle, geom)
+	}
+}
+
+// Close frees every idle frame and reports an error if frames are still
+// outstanding. Outstanding frames stay valid and are freed when they are
+// released, so a late Release after Close is not an error. The pool must not
+// be used for Acquire after Close.
+func (p *FramePool) Close() error {
+	if p == nil {
+		return nil
+	}
+	p.Trim()
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	if leaks := p.Leaks(); len(leaks) > 0 {
+		return fmt.Errorf("%d frames were not released: %v", len(leaks),
+			leaks)
+	}
+	return nil
+}
+
+// geometry returns the plane layout of frames for cs, with rows padded to the
+// alignment of the pool.
+func (p *FramePool) geometry(cs *Colorspace) frameGeometry {
+	var geom frameGeometry
+	bps := cs.bytesPerSample()
+	for i := range 3 {
+		width, height := cs.planeSize(i)
+		geom.rows[i] = height
+		geom.stride[i] = int64(alignUp(width*bps, p.opts.Alignment))
+	}
+	return geom
+}
+
+// allocate creates a new frame with the given geometry. p.mu must be held.
+func (p *FramePool) allocate(geom frameGeometry) *pooledFrame {
+	pf := &pooledFrame{frame: &Frame{LineSize: geom.stride}, geom: geom}
+	align := p.opts.Alignment
+	for i := range 3 {
+		size := int(geom.stride[i]) * geom.rows[i]
+		var buf []byte
+		if p.opts.CAllocated {
+			pf.bases[i] = C.malloc(C.size_t(size + align))
+			buf = unsafe.Slice((*byte)(pf.bases[i]), size+align)
+		} else {
+			buf = make([]byte, size+align)
+		}
+		offset := alignUp(int(uintptr(unsafe.Pointer(&buf[0]))), align) -
+			int(uintptr(unsafe.Pointer(&buf[0])))
+		pf.planes[i] = buf[offset : offset+size : offset+size]
+	}
+	pf.frame.Planes = pf.planes
+	p.allocations++
+	p.bytes += pf.size()
+	return pf
+}
+
+// free releases the memory of a frame. p.mu must be held.
+func (p *FramePool) free(pf *pooledFrame) {
+	for i, base := range pf.bases {
+		if base != nil {
+			C.free(base)
+			pf.bases[i] = nil
+		}
+	}
+	p.bytes -= pf.size()
+}
+
+func (pf *pooledFrame) size() int64 {
+	var size int64
+	for i := range 3 {
+		size += pf.geom.stride[i] * int64(pf.geom.rows[i])
+	}
+	return size
+}
+
+// alignUp rounds n up to a multiple of align, which must be a power of two.
+func alignUp(n, align int) int { return (n + align - 1) &^ (align - 1) }
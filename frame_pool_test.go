@@ -0,0 +1,91 @@
+package govship_test
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_FramePool_Reuse(t *testing.T) {
+	for _, cAllocated := range []bool{false, true} {
+		pool := vship.NewFramePool(vship.FramePoolOptions{
+			CAllocated: cAllocated})
+		var cs vship.Colorspace
+		cs.SetDefaults(100, 20, vship.SamplingFormatUInt10)
+
+		a := pool.Acquire(&cs)
+		if a.LineSize != [3]int64{256, 128, 128} {
+			t.Fatalf("LineSize = %v, want rows padded to 64 bytes",
+				a.LineSize)
+		}
+		for i, plane := range a.Planes {
+			if uintptr(unsafe.Pointer(&plane[0]))%64 != 0 {
+				t.Fatalf("plane %d is not aligned", i)
+			}
+		}
+		if len(a.Planes[0]) != 256*20 || len(a.Planes[1]) != 128*10 {
+			t.Fatalf("plane sizes = %d, %d", len(a.Planes[0]),
+				len(a.Planes[1]))
+		}
+
+		b := pool.Acquire(&cs)
+		if err := pool.Release(a); err != nil {
+			t.Fatal(err)
+		}
+		if err := pool.Release(a); err == nil {
+			t.Fatal("double release should fail")
+		}
+		if c := pool.Acquire(&cs); c != a {
+			t.Fatal("released frame was not reused")
+		}
+
+		stats := pool.Stats()
+		if stats.Allocations != 2 || stats.Outstanding != 2 ||
+			stats.Idle != 0 {
+			t.Fatalf("stats = %+v", stats)
+		}
+
+		pool.Release(b)
+		if err := pool.Close(); err == nil ||
+			!strings.Contains(err.Error(), "1 frames") {
+			t.Fatalf("Close should report one leaked frame, got %v", err)
+		}
+		if err := pool.Release(a); err != nil {
+			t.Fatal(err)
+		}
+		if stats := pool.Stats(); stats.Bytes != 0 {
+			t.Fatalf("%d bytes still held after Close", stats.Bytes)
+		}
+	}
+}
+
+func Test_FramePool_Leaks(t *testing.T) {
+	pool := vship.NewFramePool(vship.FramePoolOptions{TrackCallers: true})
+	var cs vship.Colorspace
+	cs.SetDefaults(16, 16, vship.SamplingFormatUInt8)
+
+	frame := pool.Acquire(&cs)
+	leaks := pool.Leaks()
+	if len(leaks) != 1 || !strings.Contains(leaks[0], "frame_pool_test.go") {
+		t.Fatalf("Leaks() = %v, want the acquiring test line", leaks)
+	}
+	pool.Release(frame)
+	if leaks := pool.Leaks(); len(leaks) != 0 {
+		t.Fatalf("Leaks() = %v after release", leaks)
+	}
+
+	// Helpers return their frames to the pool.
+	levels := make([]byte, 20)
+	err := vship.ScoreFramesParallel([]vship.FrameScorer{&lumaScorer{}},
+		grayFrames(16, 16, levels...), grayFrames(16, 16, levels...),
+		vship.ParallelOptions{Pool: pool},
+		func(vship.FrameScore) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package govship
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame holds the planes of a single image in the layout expected by the
+// handlers: three planes (YUV or RGB) and the byte stride of each plane.
+type Frame struct {
+	Planes   [3][]byte
+	LineSize [3]int64
+}
+
+// NewFrame allocates a Frame large enough to hold one image in the given
+// Colorspace, with rows packed without padding.
+func NewFrame(cs *Colorspace) *Frame {
+	var frame Frame
+	bps := cs.bytesPerSample()
+	for i := range frame.Planes {
+		width, height := cs.planeSize(i)
+		frame.LineSize[i] = int64(width * bps)
+		frame.Planes[i] = make([]byte, width*bps*height)
+	}
+	return &frame
+}
+
+// FrameSource delivers the frames of a sequence in presentation order.
+//
+// Implementations typically wrap a decoder or a raw file. All frames of a
+// FrameSource share the Colorspace it reports.
+type FrameSource interface {
+	// Colorspace describes the format of every frame of the source.
+	Colorspace() Colorspace
+	// ReadFrame reads the next frame into frame. Planes already present in
+	// frame are reused when they are large enough, so callers can recycle a
+	// single Frame for a whole sequence. ReadFrame returns io.EOF once every
+	// frame has been read.
+	ReadFrame(frame *Frame) error
+}
+
+// readPair reads the next frame of two sources that are expected to have the
+// same length. It returns false once both sources are exhausted and an error
+// if only one of them is.
+func readPair(ref, dist FrameSource, refFrame, distFrame *Frame,
+	index int) (bool, error) {
+	refErr := ref.ReadFrame(refFrame)
+	distErr := dist.ReadFrame(distFrame)
+
+	switch {
+	case isEOF(refErr) && isEOF(distErr):
+		return false, nil
+	case isEOF(refErr):
+		return false, fmt.Errorf("reference ended after %d frames while "+
+			"distorted continues", index)
+	case isEOF(distErr):
+		return false, fmt.Errorf("distorted ended after %d frames while "+
+			"reference continues", index)
+	case refErr != nil:
+		return false, fmt.Errorf("reading reference frame %d: %w", index,
+			refErr)
+	case distErr != nil:
+		return false, fmt.Errorf("reading distorted frame %d: %w", index,
+			distErr)
+	}
+	return true, nil
+}
+
+// isEOF reports whether err marks the end of a FrameSource.
+func isEOF(err error) bool { return errors.Is(err, io.EOF) }
+
+// RewindableFrameSource is a FrameSource that can restart from its first
+// frame. Helpers that need several passes over a sequence require it.
+type RewindableFrameSource interface {
+	FrameSource
+	// Rewind makes the next ReadFrame return the first frame again.
+	Rewind() error
+}
+
+// rewind restarts both sources of a frame pair.
+func rewind(ref, dist FrameSource) error {
+	r, ok1 := ref.(RewindableFrameSource)
+	d, ok2 := dist.(RewindableFrameSource)
+	if !ok1 || !ok2 {
+		return errors.New("frame sources must implement " +
+			"RewindableFrameSource for multiple passes")
+	}
+	if err := r.Rewind(); err != nil {
+		return err
+	}
+	return d.Rewind()
+}
+
+// FrameScorer scores pairs of frames independently of each other, as the
+// SSIMU2 and Butteraugli handlers do. CVVDP is not a FrameScorer because its
+// score depends on the frames that came before.
+type FrameScorer interface {
+	// ScoreFrame returns the score of a reference and a distorted frame.
+	ScoreFrame(ref, dist *Frame) (float64, ExceptionCode)
+}
+
+// ButteraugliFrameScorer is a FrameScorer that can report every norm of a
+// Butteraugli score rather than only the one ScoreFrame returns.
+type ButteraugliFrameScorer interface {
+	FrameScorer
+	// ScoreButteraugliFrame returns the Butteraugli score of a reference
+	// and a distorted frame.
+	ScoreButteraugliFrame(ref, dist *Frame) (ButteraugliScore,
+		ExceptionCode)
+}
+
+// copyFrame copies the planes of src into dst, reusing the planes of dst when
+// they are large enough.
+func copyFrame(dst, src *Frame) {
+	for i := range src.Planes {
+		if cap(dst.Planes[i]) < len(src.Planes[i]) {
+			dst.Planes[i] = make([]byte, len(src.Planes[i]))
+		}
+		dst.Planes[i] = dst.Planes[i][:len(src.Planes[i])]
+		copy(dst.Planes[i], src.Planes[i])
+	}
+	dst.LineSize = src.LineSize
+}
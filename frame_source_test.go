@@ -0,0 +1,74 @@
+package govship_test
+
+import (
+	"io"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// memorySource is a FrameSource serving frames held in memory.
+type memorySource struct {
+	cs     vship.Colorspace
+	frames []*vship.Frame
+	next   int
+}
+
+func (s *memorySource) Colorspace() vship.Colorspace { return s.cs }
+
+func (s *memorySource) ReadFrame(frame *vship.Frame) error {
+	if s.next >= len(s.frames) {
+		return io.EOF
+	}
+	src := s.frames[s.next]
+	s.next++
+	for i := range frame.Planes {
+		if len(frame.Planes[i]) < len(src.Planes[i]) {
+			frame.Planes[i] = make([]byte, len(src.Planes[i]))
+		}
+		copy(frame.Planes[i], src.Planes[i])
+	}
+	frame.LineSize = src.LineSize
+	return nil
+}
+
+func (s *memorySource) Rewind() error {
+	s.next = 0
+	return nil
+}
+
+// grayFrames returns a memorySource of 8-bit 4:2:0 frames where every luma
+// sample of frame i is levels[i].
+func grayFrames(width, height int64, levels ...byte) *memorySource {
+	src := &memorySource{}
+	src.cs.SetDefaults(width, height, vship.SamplingFormatUInt8)
+	for _, level := range levels {
+		frame := vship.NewFrame(&src.cs)
+		for i := range frame.Planes[0] {
+			frame.Planes[0][i] = level
+		}
+		src.frames = append(src.frames, frame)
+	}
+	return src
+}
+
+func Test_NewFrame(t *testing.T) {
+	var cs vship.Colorspace
+	cs.SetDefaults(7, 5, vship.SamplingFormatUInt10)
+
+	frame := vship.NewFrame(&cs)
+	if frame.LineSize != [3]int64{14, 8, 8} {
+		t.Fatalf("LineSize = %v, want [14 8 8]", frame.LineSize)
+	}
+	if len(frame.Planes[0]) != 70 || len(frame.Planes[1]) != 24 {
+		t.Fatalf("plane sizes = %d, %d, want 70, 24", len(frame.Planes[0]),
+			len(frame.Planes[1]))
+	}
+
+	cs.ColorFamily = vship.ColorFamilyRGB
+	frame = vship.NewFrame(&cs)
+	if len(frame.Planes[2]) != 70 {
+		t.Fatalf("RGB planes should not be subsampled, got %d bytes",
+			len(frame.Planes[2]))
+	}
+}
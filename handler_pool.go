@@ -0,0 +1,205 @@
+package govship
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Handler is implemented by every metric handler: *SSIMU2Handler,
+// *ButteraugliHandler and *CVVDPHandler.
+type Handler interface {
+	Close() ExceptionCode
+}
+
+// NewHandler creates the handler described by spec.
+func (s HandlerSpec) NewHandler() (Handler, ExceptionCode) {
+	var h Handler
+	code := withDevice(s.Device, func() ExceptionCode {
+		var code ExceptionCode
+		switch s.Metric {
+		case MetricSSIMU2:
+			var ssimu2 *SSIMU2Handler
+			if ssimu2, code = NewSSIMU2Handler(&s.Source,
+				&s.Distorted); code.IsNone() {
+				h = ssimu2
+			}
+		case MetricButteraugli:
+			brightness := s.DisplayBrightness
+			if brightness <= 0 {
+				brightness = ButteraugliIntensityTarget(&s.Source, nil)
+			}
+			var butter *ButteraugliHandler
+			if butter, code = NewButteraugliHandler(&s.Source, &s.Distorted,
+				s.Qnorm, brightness); code.IsNone() {
+				h = butter
+			}
+		case MetricCVVDP:
+			var cvvdp *CVVDPHandler
+			if s.ConfigJSON == "" {
+				cvvdp, code = NewCVVDPHandler(&s.Source, &s.Distorted, s.FPS,
+					s.ResizeToDisplay, s.ModelKey)
+			} else {
+				cvvdp, code = NewCVVDPHandlerWithConfig(&s.Source,
+					&s.Distorted, s.FPS, s.ResizeToDisplay, s.ModelKey,
+					s.ConfigJSON)
+			}
+			if code.IsNone() {
+				h = cvvdp
+			}
+		default:
+			code = ExceptionCodeBadHandler
+		}
+		return code
+	})
+	return h, code
+}
+
+// deviceChanged records whether SetDevice ever selected a device other than
+// 0, after which any thread may have been left on another device.
+var deviceChanged atomic.Bool
+
+// withDevice runs fn with device selected for the calling thread. Vship
+// selects devices per host thread, so the goroutine is locked to its thread
+// for the duration of fn. Device 0 is selected too once another device has
+// been used, as the thread may have been left on it; until then every thread
+// is still on device 0.
+func withDevice(device int, fn func() ExceptionCode) ExceptionCode {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if device != 0 || deviceChanged.Load() {
+		if code := SetDevice(device); !code.IsNone() {
+			return code
+		}
+	}
+	return fn()
+}
+
+// HandlerPoolOptions configures a HandlerPool.
+type HandlerPoolOptions struct {
+	// Schedulers admit new handlers on each device, keyed by the Device of
+	// their HandlerSpec. Devices without a scheduler are not limited.
+	Schedulers map[int]*VRAMScheduler
+	// New creates handlers. Defaults to HandlerSpec.NewHandler.
+	New func(HandlerSpec) (Handler, ExceptionCode)
+}
+
+// HandlerPool keeps idle handlers so that they can be reused instead of
+// being created again, which is much slower than a Reset.
+//
+// Handlers are obtained with Get and given back with Put once the work they
+// were used for is done. When schedulers are configured, every handler holds
+// a VRAM reservation for as long as it exists, and idle handlers are closed to
+// make room before a new handler is refused. A HandlerPool is safe for
+// concurrent use, while each handler it returns is used by one goroutine at a
+// time.
+type HandlerPool struct {
+	opts HandlerPoolOptions
+
+	mu    sync.Mutex
+	idle  map[HandlerSpec][]Handler
+	owned map[Handler]pooledHandler
+}
+
+// pooledHandler records where a handler of the pool lives.
+type pooledHandler struct {
+	device      int
+	reservation *VRAMReservation
+}
+
+// NewHandlerPool creates an empty HandlerPool.
+func NewHandlerPool(opts HandlerPoolOptions) *HandlerPool {
+	if opts.New == nil {
+		opts.New = HandlerSpec.NewHandler
+	}
+	return &HandlerPool{opts: opts,
+		idle:  make(map[HandlerSpec][]Handler),
+		owned: make(map[Handler]pooledHandler)}
+}
+
+// Get returns an idle handler for spec or creates a new one. It returns
+// ExceptionCodeOutOfVRAM without creating a handler if the scheduler of the
+// device refuses it even after the idle handlers were closed.
+func (p *HandlerPool) Get(spec HandlerSpec) (Handler, ExceptionCode) {
+	p.mu.Lock()
+	if idle := p.idle[spec]; len(idle) > 0 {
+		h := idle[len(idle)-1]
+		p.idle[spec] = idle[:len(idle)-1]
+		p.mu.Unlock()
+		return h, ExceptionCodeNoError
+	}
+	p.mu.Unlock()
+
+	var reservation *VRAMReservation
+	if scheduler := p.opts.Schedulers[spec.Device]; scheduler != nil {
+		var ok bool
+		if reservation, ok = scheduler.TryReserve(spec); !ok {
+			p.FreeIdle()
+			if reservation, ok = scheduler.TryReserve(spec); !ok {
+				return nil, ExceptionCodeOutOfVRAM
+			}
+		}
+	}
+
+	h, code := p.opts.New(spec)
+	if !code.IsNone() {
+		if reservation != nil {
+			reservation.Release()
+		}
+		return nil, code
+	}
+	p.mu.Lock()
+	p.owned[h] = pooledHandler{spec.Device, reservation}
+	p.mu.Unlock()
+	return h, code
+}
+
+// Put returns a handler obtained from Get for spec to the pool. CVVDP
+// handlers are Reset first so that the next user starts from a clean
+// temporal state.
+func (p *HandlerPool) Put(spec HandlerSpec, h Handler) {
+	if cvvdp, ok := h.(*CVVDPHandler); ok {
+		if code := withDevice(spec.Device, cvvdp.Reset); !code.IsNone() {
+			p.Discard(h)
+			return
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle[spec] = append(p.idle[spec], h)
+}
+
+// Discard closes a handler obtained from Get instead of returning it to the
+// pool, for instance after it failed.
+func (p *HandlerPool) Discard(h Handler) ExceptionCode {
+	p.mu.Lock()
+	owned := p.owned[h]
+	delete(p.owned, h)
+	p.mu.Unlock()
+
+	code := withDevice(owned.device, h.Close)
+	if owned.reservation != nil {
+		owned.reservation.Release()
+	}
+	return code
+}
+
+// FreeIdle closes every idle handler and returns how many were closed.
+func (p *HandlerPool) FreeIdle() int {
+	p.mu.Lock()
+	var handlers []Handler
+	for spec, idle := range p.idle {
+		handlers = append(handlers, idle...)
+		delete(p.idle, spec)
+	}
+	p.mu.Unlock()
+
+	for _, h := range handlers {
+		p.Discard(h)
+	}
+	return len(handlers)
+}
+
+// Close closes every idle handler. Handlers still in use are not affected
+// and should be discarded by their users.
+func (p *HandlerPool) Close() { p.FreeIdle() }
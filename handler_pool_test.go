@@ -0,0 +1,82 @@
+package govship_test
+
+import (
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// fakeHandler is a FrameScorer handler that runs out of memory above a
+// given number of processed pixels.
+type fakeHandler struct {
+	pixels, limit int64
+	closed        *int
+}
+
+func (h *fakeHandler) Close() vship.ExceptionCode {
+	*h.closed++
+	return vship.ExceptionCodeNoError
+}
+
+func (h *fakeHandler) ScoreFrame(ref, dist *vship.Frame) (float64,
+	vship.ExceptionCode) {
+	if h.pixels > h.limit {
+		return 0, vship.ExceptionCodeOutOfVRAM
+	}
+	return float64(h.pixels), vship.ExceptionCodeNoError
+}
+
+func fakePool(limit int64, created, closed *int) *vship.HandlerPool {
+	return vship.NewHandlerPool(vship.HandlerPoolOptions{
+		New: func(spec vship.HandlerSpec) (vship.Handler,
+			vship.ExceptionCode) {
+			*created++
+			w, h := spec.Source.TargetWidth, spec.Source.TargetHeight
+			if w <= 0 {
+				w, h = spec.Source.Width, spec.Source.Height
+			}
+			return &fakeHandler{w * h, limit, closed},
+				vship.ExceptionCodeNoError
+		}})
+}
+
+func Test_HandlerPool(t *testing.T) {
+	var created, closed int
+	pool := fakePool(1<<40, &created, &closed)
+	spec := vship.HandlerSpec{Metric: vship.MetricSSIMU2}
+	spec.Source.SetDefaults(64, 64, vship.SamplingFormatUInt8)
+
+	a, _ := pool.Get(spec)
+	pool.Put(spec, a)
+	b, _ := pool.Get(spec)
+	if a != b || created != 1 {
+		t.Fatalf("idle handler was not reused, created %d", created)
+	}
+	pool.Put(spec, b)
+	if n := pool.FreeIdle(); n != 1 || closed != 1 {
+		t.Fatalf("FreeIdle closed %d handlers (%d calls)", n, closed)
+	}
+
+	// A scheduler with room for one handler frees idle handlers before
+	// refusing new ones.
+	budget := vship.EstimateVRAM(spec)
+	s, _ := vship.NewVRAMScheduler(0, vship.VRAMSchedulerOptions{
+		Budget: budget})
+	pool = vship.NewHandlerPool(vship.HandlerPoolOptions{
+		Schedulers: map[int]*vship.VRAMScheduler{0: s},
+		New: func(vship.HandlerSpec) (vship.Handler,
+			vship.ExceptionCode) {
+			return &fakeHandler{closed: &closed},
+				vship.ExceptionCodeNoError
+		}})
+	a, _ = pool.Get(spec)
+	if _, code := pool.Get(spec); code != vship.ExceptionCodeOutOfVRAM {
+		t.Fatalf("second handler should not fit, got %v", code)
+	}
+	other := spec
+	other.Source.Width = 32
+	pool.Put(spec, a)
+	if _, code := pool.Get(other); !code.IsNone() {
+		t.Fatalf("idle handler should make room, got %v", code)
+	}
+}
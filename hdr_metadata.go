@@ -0,0 +1,206 @@
+package govship
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MasteringDisplay holds SMPTE ST 2086 mastering display color volume
+// metadata: the display an HDR title was graded on.
+type MasteringDisplay struct {
+	// CIE 1931 xy chromaticities of the primaries and the white point.
+	RedX, RedY, GreenX, GreenY, BlueX, BlueY float64
+	WhiteX, WhiteY                           float64
+	// Luminance range of the display in cd/m².
+	MinLuminance, MaxLuminance float64
+}
+
+// ContentLightLevel holds the CTA-861.3 content light level of an HDR
+// title in cd/m².
+type ContentLightLevel struct {
+	// MaxCLL is the brightest pixel of the title, MaxFALL the brightest
+	// frame average.
+	MaxCLL, MaxFALL float64
+}
+
+// HDR10Metadata is the static metadata of an HDR10 stream. Either part may
+// be nil when the stream does not carry it.
+type HDR10Metadata struct {
+	Mastering    *MasteringDisplay
+	ContentLight *ContentLightLevel
+}
+
+// defaultHDRPeak is the peak luminance assumed for HDR10 streams without
+// metadata, the level most HDR10 content is mastered to.
+const defaultHDRPeak = 1000
+
+// PeakLuminance returns the highest luminance in cd/m² the title was
+// intended to be seen at: the peak of the mastering display, else MaxCLL,
+// else 1000.
+func (h HDR10Metadata) PeakLuminance() float64 {
+	switch {
+	case h.Mastering != nil && h.Mastering.MaxLuminance > 0:
+		return h.Mastering.MaxLuminance
+	case h.ContentLight != nil && h.ContentLight.MaxCLL > 0:
+		return h.ContentLight.MaxCLL
+	}
+	return defaultHDRPeak
+}
+
+// DisplayBrightnessInNits returns the display brightness to pass to
+// NewButteraugliHandler for the title. It is always 10000 cd/m², as returned
+// by ButteraugliIntensityTarget for PQ: HDR10 is coded in PQ, whose full
+// scale is absolute whatever display the title was mastered on, so the
+// metadata only affects DisplayModel.
+func (h HDR10Metadata) DisplayBrightnessInNits() float32 {
+	return pqPeakLuminance
+}
+
+// DisplayModel returns base turned into the mastering display: an HDR model
+// with the peak luminance of the title and, if the mastering display states
+// its black level, its contrast. Resolution, geometry and viewing conditions
+// come from base; DisplayModelPresetStandardHDR or
+// DisplayModelPresetStandardHDRDarkRoom match typical grading environments.
+// The primaries are not part of the CVVDP display model and are ignored.
+func (h HDR10Metadata) DisplayModel(base DisplayModel) DisplayModel {
+	m := base
+	m.ColorSpace = DisplayModelColorspaceHDR
+	m.DisplayMaxLuminance = float32(h.PeakLuminance())
+	if md := h.Mastering; md != nil && md.MinLuminance > 0 &&
+		md.MaxLuminance > 0 {
+		m.MonitorContrastRatio = int(math.Round(md.MaxLuminance /
+			md.MinLuminance))
+	}
+	return m
+}
+
+// ffprobe side data types of the HDR10 metadata.
+const (
+	ffprobeMasteringDisplay  = "Mastering display metadata"
+	ffprobeContentLightLevel = "Content light level metadata"
+)
+
+// ParseFFprobeHDR10 extracts HDR10 metadata from the JSON output of ffprobe,
+// e.g. of
+//
+//	ffprobe -of json -show_frames -read_intervals %+#1 video.mkv
+//
+// The first mastering display and content light level side data found in
+// any side_data_list of the output are used. An error is returned when the
+// output holds neither.
+func ParseFFprobeHDR10(data []byte) (HDR10Metadata, error) {
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return HDR10Metadata{}, fmt.Errorf("parsing ffprobe output: %w", err)
+	}
+
+	var h HDR10Metadata
+	var err error
+	walkFFprobeSideData(root, func(sd map[string]any) {
+		if err != nil {
+			return
+		}
+		switch sd["side_data_type"] {
+		case ffprobeMasteringDisplay:
+			if h.Mastering == nil {
+				h.Mastering, err = parseFFprobeMastering(sd)
+			}
+		case ffprobeContentLightLevel:
+			if h.ContentLight == nil {
+				h.ContentLight, err = parseFFprobeContentLight(sd)
+			}
+		}
+	})
+	if err != nil {
+		return HDR10Metadata{}, err
+	}
+	if h.Mastering == nil && h.ContentLight == nil {
+		return HDR10Metadata{}, errors.New("ffprobe output has no HDR10 " +
+			"side data")
+	}
+	return h, nil
+}
+
+// walkFFprobeSideData calls fn for every object with a side_data_type in v.
+func walkFFprobeSideData(v any, fn func(map[string]any)) {
+	switch v := v.(type) {
+	case map[string]any:
+		if _, ok := v["side_data_type"]; ok {
+			fn(v)
+			return
+		}
+		for _, child := range v {
+			walkFFprobeSideData(child, fn)
+		}
+	case []any:
+		for _, child := range v {
+			walkFFprobeSideData(child, fn)
+		}
+	}
+}
+
+func parseFFprobeMastering(sd map[string]any) (*MasteringDisplay, error) {
+	var md MasteringDisplay
+	for _, field := range []struct {
+		key string
+		dst *float64
+	}{
+		{"red_x", &md.RedX}, {"red_y", &md.RedY},
+		{"green_x", &md.GreenX}, {"green_y", &md.GreenY},
+		{"blue_x", &md.BlueX}, {"blue_y", &md.BlueY},
+		{"white_point_x", &md.WhiteX}, {"white_point_y", &md.WhiteY},
+		{"min_luminance", &md.MinLuminance},
+		{"max_luminance", &md.MaxLuminance},
+	} {
+		v, err := ffprobeNumber(sd[field.key])
+		if err != nil {
+			return nil, fmt.Errorf("mastering display %s: %w", field.key,
+				err)
+		}
+		*field.dst = v
+	}
+	return &md, nil
+}
+
+func parseFFprobeContentLight(sd map[string]any) (*ContentLightLevel,
+	error) {
+	maxCLL, err := ffprobeNumber(sd["max_content"])
+	if err != nil {
+		return nil, fmt.Errorf("content light level max_content: %w", err)
+	}
+	maxFALL, err := ffprobeNumber(sd["max_average"])
+	if err != nil {
+		return nil, fmt.Errorf("content light level max_average: %w", err)
+	}
+	return &ContentLightLevel{MaxCLL: maxCLL, MaxFALL: maxFALL}, nil
+}
+
+// ffprobeNumber decodes a side data value, a JSON number or a rational
+// string such as "34000/50000".
+func ffprobeNumber(v any) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case string:
+		num, den, rational := strings.Cut(v, "/")
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil || !rational {
+			return n, err
+		}
+		d, err := strconv.ParseFloat(den, 64)
+		if err != nil {
+			return 0, err
+		}
+		if d == 0 {
+			return 0, fmt.Errorf("rational %q has a zero denominator", v)
+		}
+		return n / d, nil
+	case nil:
+		return 0, errors.New("missing")
+	}
+	return 0, fmt.Errorf("unexpected value %v", v)
+}
@@ -0,0 +1,89 @@
+package govship_test
+
+import (
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// ffprobeFrames is trimmed ffprobe -show_frames output of an HDR10 stream.
+const ffprobeFrames = `{
+    "frames": [
+        {
+            "media_type": "video",
+            "side_data_list": [
+                {
+                    "side_data_type": "Mastering display metadata",
+                    "red_x": "34000/50000",
+                    "red_y": "16000/50000",
+                    "green_x": "13250/50000",
+                    "green_y": "34500/50000",
+                    "blue_x": "7500/50000",
+                    "blue_y": "3000/50000",
+                    "white_point_x": "15635/50000",
+                    "white_point_y": "16450/50000",
+                    "min_luminance": "50/10000",
+                    "max_luminance": "40000000/10000"
+                },
+                {
+                    "side_data_type": "Content light level metadata",
+                    "max_content": 1100,
+                    "max_average": 400
+                }
+            ]
+        }
+    ]
+}`
+
+func Test_ParseFFprobeHDR10(t *testing.T) {
+	h, err := vship.ParseFFprobeHDR10([]byte(ffprobeFrames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := h.Mastering
+	if md == nil || md.RedX != 0.68 || md.WhiteY != 0.329 ||
+		md.MinLuminance != 0.005 || md.MaxLuminance != 4000 {
+		t.Fatalf("unexpected mastering display %+v", md)
+	}
+	if cl := h.ContentLight; cl == nil || cl.MaxCLL != 1100 ||
+		cl.MaxFALL != 400 {
+		t.Fatalf("unexpected content light level %+v", cl)
+	}
+
+	for _, bad := range []string{`{"frames": [{"side_data_list": []}]}`,
+		`{"side_data_list": [{"side_data_type": "Mastering display ` +
+			`metadata", "red_x": "1/0"}]}`, `[`} {
+		if _, err := vship.ParseFFprobeHDR10([]byte(bad)); err == nil {
+			t.Fatalf("%s should be rejected", bad)
+		}
+	}
+}
+
+func Test_HDR10Metadata_DisplayModel(t *testing.T) {
+	h, err := vship.ParseFFprobeHDR10([]byte(ffprobeFrames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := vship.DisplayModelPresetStandard4K
+	m := h.DisplayModel(base)
+	if m.ColorSpace != vship.DisplayModelColorspaceHDR ||
+		m.DisplayMaxLuminance != 4000 || m.MonitorContrastRatio != 800000 ||
+		m.AmbientLightLevel != base.AmbientLightLevel {
+		t.Fatalf("unexpected model %+v", m)
+	}
+	// PQ is absolute, so Butteraugli sees full scale at 10000 cd/m² and
+	// not at the mastering peak.
+	if h.DisplayBrightnessInNits() != 10000 {
+		t.Fatalf("brightness = %v", h.DisplayBrightnessInNits())
+	}
+
+	cllOnly := vship.HDR10Metadata{
+		ContentLight: &vship.ContentLightLevel{MaxCLL: 600}}
+	if cllOnly.PeakLuminance() != 600 ||
+		cllOnly.DisplayModel(base).MonitorContrastRatio != 1000 {
+		t.Fatal("MaxCLL should set the peak and keep the base contrast")
+	}
+	if (vship.HDR10Metadata{}).PeakLuminance() != 1000 {
+		t.Fatal("missing metadata should assume 1000 cd/m²")
+	}
+}
@@ -0,0 +1,258 @@
+package govship
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Palette selects the false-colour gradient used to render a heatmap.
+type Palette int
+
+const (
+	// PaletteViridis is perceptually uniform and readable by colour-blind
+	// viewers. It is the default.
+	PaletteViridis Palette = iota
+	// PaletteTurbo is a high-contrast rainbow gradient that makes small
+	// differences between values easy to spot.
+	PaletteTurbo
+	// PaletteJet is the classic MATLAB rainbow gradient.
+	PaletteJet
+)
+
+// HeatmapOptions controls how a DistortionMap is rendered to an image.
+type HeatmapOptions struct {
+	// Palette used to colour the values.
+	Palette Palette
+	// Min and Max fix the range of values mapped onto the palette. Values
+	// outside the range are clamped. When Max is not greater than Min the
+	// range is taken from the smallest and largest value of the map.
+	Min, Max float32
+	// Legend appends a colour bar labelled with the range to the right side
+	// of the image.
+	Legend bool
+	// Background, if non-nil, is blended under the heatmap. It is usually the
+	// luma of the reference frame as returned by LumaImage. It is scaled to
+	// the size of the map with nearest neighbour sampling.
+	Background *image.Gray
+	// Alpha is the opacity of the heatmap over Background, between 0 and 1.
+	// An Alpha of 0 selects 0.5. It is ignored when Background is nil.
+	Alpha float32
+}
+
+// Sizes of the legend, in pixels.
+const (
+	heatmapLegendMargin = 8
+	heatmapLegendBar    = 16
+	heatmapGlyphScale   = 2
+)
+
+// Heatmap renders the map as a false-colour image.
+//
+// The image has the size of the map, plus room for the colour bar when
+// opts.Legend is set.
+func (m *DistortionMap) Heatmap(opts HeatmapOptions) *image.RGBA {
+	lo, hi := opts.Min, opts.Max
+	if hi <= lo {
+		lo, hi = m.valueRange()
+	}
+
+	lowLabel := strconv.FormatFloat(float64(lo), 'g', 3, 32)
+	highLabel := strconv.FormatFloat(float64(hi), 'g', 3, 32)
+
+	width := m.Width
+	if opts.Legend {
+		labelWidth := max(textWidth(lowLabel), textWidth(highLabel))
+		width += 2*heatmapLegendMargin + heatmapLegendBar + labelWidth
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, m.Height))
+
+	alpha := min(max(opts.Alpha, 0), 1)
+	if alpha == 0 {
+		alpha = 0.5
+	}
+	for y := range m.Height {
+		for x := range m.Width {
+			c := opts.Palette.color(normalize(m.At(x, y), lo, hi))
+			if opts.Background != nil {
+				c = blend(c, backgroundAt(opts.Background, x, y, m.Width,
+					m.Height), alpha)
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	if opts.Legend {
+		drawLegend(img, m.Width+heatmapLegendMargin, opts.Palette, lowLabel,
+			highLabel)
+	}
+	return img
+}
+
+// WriteHeatmapPNG renders the map with Heatmap and encodes it as PNG to w.
+func (m *DistortionMap) WriteHeatmapPNG(w io.Writer, opts HeatmapOptions,
+) error {
+	return png.Encode(w, m.Heatmap(opts))
+}
+
+// WriteHeatmapPNGFile renders the map with Heatmap and writes it as a PNG file
+// at the given path. Returns an error if encoding or writing fails.
+func (m *DistortionMap) WriteHeatmapPNGFile(filePath string,
+	opts HeatmapOptions) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	if err := m.WriteHeatmapPNG(f, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// valueRange returns the smallest and largest value in the map, widened to a
+// non-empty range.
+func (m *DistortionMap) valueRange() (lo, hi float32) {
+	if len(m.Data) == 0 {
+		return 0, 1
+	}
+	lo, hi = m.Data[0], m.Data[0]
+	for _, v := range m.Data {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	if hi <= lo {
+		hi = lo + 1
+	}
+	return lo, hi
+}
+
+func normalize(v, lo, hi float32) float64 {
+	return min(max(float64((v-lo)/(hi-lo)), 0), 1)
+}
+
+// color maps t in [0, 1] onto the palette.
+func (p Palette) color(t float64) color.RGBA {
+	var r, g, b float64
+	switch p {
+	case PaletteTurbo:
+		// Polynomial approximation of Google's Turbo colormap.
+		r = 0.13572138 + t*(4.61539260+t*(-42.66032258+t*(132.13108234+
+			t*(-152.94239396+t*59.28637943))))
+		g = 0.09140261 + t*(2.19418839+t*(4.84296658+t*(-14.18503333+
+			t*(4.27729857+t*2.82956604))))
+		b = 0.10667330 + t*(12.64194608+t*(-60.58204836+t*(110.36276771+
+			t*(-89.90310912+t*27.34824973))))
+	case PaletteJet:
+		r = 1.5 - math.Abs(4*t-3)
+		g = 1.5 - math.Abs(4*t-2)
+		b = 1.5 - math.Abs(4*t-1)
+	default:
+		// Polynomial approximation of matplotlib's viridis colormap.
+		r = 0.2777273272234177 + t*(0.1050930431085774+
+			t*(-0.3308618287255563+t*(-4.634230498983486+
+				t*(6.228269936347081+t*(4.776384997670288+
+					t*-5.435455855934631)))))
+		g = 0.005407344544966578 + t*(1.404613529898575+
+			t*(0.214847559468213+t*(-5.799100973351585+
+				t*(14.17993336680509+t*(-13.74514537774601+
+					t*4.645852612178535)))))
+		b = 0.3340998053353061 + t*(1.384590162594685+
+			t*(0.09509516302823659+t*(-19.33244095627987+
+				t*(56.69055260068105+t*(-65.35303263337234+
+					t*26.3124352495832)))))
+	}
+	return color.RGBA{toUint8(r), toUint8(g), toUint8(b), 255}
+}
+
+func toUint8(v float64) uint8 {
+	return uint8(math.Round(min(max(v, 0), 1) * 255))
+}
+
+// backgroundAt samples the background at the map position (x, y) using
+// nearest neighbour scaling.
+func backgroundAt(bg *image.Gray, x, y, width, height int) uint8 {
+	b := bg.Bounds()
+	bx := b.Min.X + x*b.Dx()/width
+	by := b.Min.Y + y*b.Dy()/height
+	return bg.GrayAt(bx, by).Y
+}
+
+func blend(c color.RGBA, luma uint8, alpha float32) color.RGBA {
+	mix := func(v uint8) uint8 {
+		return uint8(math.Round(float64(alpha)*float64(v) +
+			float64(1-alpha)*float64(luma)))
+	}
+	return color.RGBA{mix(c.R), mix(c.G), mix(c.B), 255}
+}
+
+// drawLegend draws a vertical colour bar starting at column x0 with the high
+// label at the top and the low label at the bottom.
+func drawLegend(img *image.RGBA, x0 int, p Palette, lowLabel,
+	highLabel string) {
+	bounds := img.Bounds()
+	height := bounds.Dy()
+	black := color.RGBA{0, 0, 0, 255}
+	for y := range height {
+		for x := x0 - heatmapLegendMargin; x < bounds.Max.X; x++ {
+			img.SetRGBA(x, y, black)
+		}
+	}
+
+	for y := range height {
+		c := p.color(1 - float64(y)/float64(max(height-1, 1)))
+		for x := x0; x < x0+heatmapLegendBar; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	white := color.RGBA{255, 255, 255, 255}
+	labelX := x0 + heatmapLegendBar + heatmapLegendMargin/2
+	drawText(img, labelX, 0, highLabel, white)
+	drawText(img, labelX, height-glyphHeight*heatmapGlyphScale, lowLabel,
+		white)
+}
+
+// glyphs is a minimal 3x5 bitmap font covering the characters produced by
+// strconv.FormatFloat. Each row holds three bits, most significant bit on
+// the left.
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7}, '4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1}, '8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7}, '.': {0, 0, 0, 0, 2}, '-': {0, 0, 7, 0, 0},
+	'+': {0, 2, 7, 2, 0}, 'e': {0, 7, 7, 4, 7},
+}
+
+const (
+	glyphWidth   = 3
+	glyphHeight  = 5
+	glyphAdvance = glyphWidth + 1
+)
+
+func textWidth(s string) int {
+	return len(s) * glyphAdvance * heatmapGlyphScale
+}
+
+func drawText(img *image.RGBA, x0, y0 int, s string, c color.RGBA) {
+	for i, r := range s {
+		glyph := glyphs[r]
+		gx := x0 + i*glyphAdvance*heatmapGlyphScale
+		for row := range glyphHeight {
+			for col := range glyphWidth {
+				if glyph[row]&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				for dy := range heatmapGlyphScale {
+					for dx := range heatmapGlyphScale {
+						img.SetRGBA(gx+col*heatmapGlyphScale+dx,
+							y0+row*heatmapGlyphScale+dy, c)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package govship_test
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_DistortionMap_Heatmap(t *testing.T) {
+	dmap := vship.NewDistortionMap(16, 8)
+	for i := range dmap.Data {
+		dmap.Data[i] = float32(i % 16)
+	}
+
+	for _, palette := range []vship.Palette{vship.PaletteViridis,
+		vship.PaletteTurbo, vship.PaletteJet} {
+		img := dmap.Heatmap(vship.HeatmapOptions{Palette: palette})
+		if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+			t.Fatalf("heatmap size = %v, want 16x8", img.Bounds())
+		}
+		if img.RGBAAt(0, 0) == img.RGBAAt(15, 0) {
+			t.Fatalf("palette %d renders min and max with the same colour",
+				palette)
+		}
+	}
+
+	// A fixed range that saturates every value renders a uniform image.
+	img := dmap.Heatmap(vship.HeatmapOptions{Min: -2, Max: -1})
+	if img.RGBAAt(0, 0) != img.RGBAAt(15, 7) {
+		t.Fatal("values above a fixed range should be clamped")
+	}
+
+	img = dmap.Heatmap(vship.HeatmapOptions{Legend: true})
+	if img.Bounds().Dx() <= 16 {
+		t.Fatal("legend should widen the image")
+	}
+
+	var buf bytes.Buffer
+	if err := dmap.WriteHeatmapPNG(&buf, vship.HeatmapOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(&buf); err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+}
+
+func Test_LumaImage_Overlay(t *testing.T) {
+	var cs vship.Colorspace
+	cs.SetDefaults(4, 2, vship.SamplingFormatUInt8)
+
+	planes := [3][]byte{
+		{16, 16, 235, 235, 16, 16, 235, 235},
+		make([]byte, 4),
+		make([]byte, 4),
+	}
+	lineSize := [3]int64{4, 2, 2}
+
+	luma, err := vship.LumaImage(&cs, planes, lineSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if luma.GrayAt(0, 0).Y != 0 || luma.GrayAt(3, 1).Y != 255 {
+		t.Fatalf("limited range luma not expanded: %v", luma.Pix)
+	}
+
+	dmap := vship.NewDistortionMap(2, 1)
+	img := dmap.Heatmap(vship.HeatmapOptions{Background: luma, Alpha: 0.001})
+	if img.RGBAAt(0, 0).G > 1 || img.RGBAAt(1, 0).G < 254 {
+		t.Fatalf("background not blended: %v %v", img.RGBAAt(0, 0),
+			img.RGBAAt(1, 0))
+	}
+}
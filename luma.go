@@ -0,0 +1,132 @@
+package govship
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+)
+
+// LumaImage extracts the luma of an image as an 8-bit grayscale image.
+//
+// planes and lineSize describe the image in the layout given by cs, exactly
+// as they are passed to the handlers. For YUV images the Y plane is used
+// directly; for RGB images luma is computed with BT.709 weights. Limited
+// range input is expanded to full range and the crop rectangle of cs is
+// applied, so the result lines up with distortion maps of the same image.
+func LumaImage(cs *Colorspace, planes [3][]byte, lineSize [3]int64,
+) (*image.Gray, error) {
+	width, height, luma, err := readLuma(cs, planes, lineSize, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i, v := range luma {
+		img.Pix[i] = uint8(math.Round(float64(min(max(v, 0), 1)) * 255))
+	}
+	return img, nil
+}
+
+// readLuma returns the cropped luma of an image normalized to [0, 1].
+//
+// Only every step-th pixel in each direction is read, which gives a cheap
+// low resolution version of the frame for analysis passes such as scene cut
+// detection.
+func readLuma(cs *Colorspace, planes [3][]byte, lineSize [3]int64,
+	step int) (width, height int, luma []float32, err error) {
+	step = max(step, 1)
+	cropW := int(cs.Width) - cs.CropLeft - cs.CropRight
+	cropH := int(cs.Height) - cs.CropTop - cs.CropBottom
+	if cropW <= 0 || cropH <= 0 {
+		return 0, 0, nil, fmt.Errorf("empty image after cropping")
+	}
+
+	numPlanes := 1
+	if cs.ColorFamily == ColorFamilyRGB {
+		numPlanes = 3
+	}
+	bps := cs.bytesPerSample()
+	for i := range numPlanes {
+		need := lineSize[i]*(cs.Height-1) + cs.Width*int64(bps)
+		if int64(len(planes[i])) < need {
+			return 0, 0, nil, fmt.Errorf("plane %d holds %d bytes, need %d",
+				i, len(planes[i]), need)
+		}
+	}
+
+	width = (cropW + step - 1) / step
+	height = (cropH + step - 1) / step
+	luma = make([]float32, width*height)
+
+	for y := range height {
+		sy := cs.CropTop + y*step
+		for x := range width {
+			sx := cs.CropLeft + x*step
+			if numPlanes == 1 {
+				luma[y*width+x] = cs.normalizedSample(planes[0], lineSize[0],
+					sx, sy, true)
+				continue
+			}
+			r := cs.normalizedSample(planes[0], lineSize[0], sx, sy, true)
+			g := cs.normalizedSample(planes[1], lineSize[1], sx, sy, true)
+			b := cs.normalizedSample(planes[2], lineSize[2], sx, sy, true)
+			luma[y*width+x] = 0.2126*r + 0.7152*g + 0.0722*b
+		}
+	}
+	return width, height, luma, nil
+}
+
+// normalizedSample reads the sample at (x, y) of a plane and maps it to
+// [0, 1]. Limited range integer samples are expanded using the luma range
+// when isLuma is true and the chroma range otherwise.
+func (c *Colorspace) normalizedSample(plane []byte, lineSize int64, x,
+	y int, isLuma bool) float32 {
+	offset := int64(y)*lineSize + int64(x*c.bytesPerSample())
+
+	switch c.SamplingFormat {
+	case SamplingFormatFloat:
+		return math.Float32frombits(
+			binary.LittleEndian.Uint32(plane[offset:]))
+	case SamplingFormatHalf:
+		return halfToFloat32(binary.LittleEndian.Uint16(plane[offset:]))
+	}
+
+	var v float32
+	if c.SamplingFormat == SamplingFormatUInt8 {
+		v = float32(plane[offset])
+	} else {
+		v = float32(binary.LittleEndian.Uint16(plane[offset:]))
+	}
+
+	scale := float32(int(1) << (c.bitDepth() - 8))
+	if c.ColorRange == ColorRangeFull {
+		return v / float32(int(1)<<c.bitDepth()-1)
+	}
+	if isLuma {
+		return (v - 16*scale) / (219 * scale)
+	}
+	return (v - 16*scale) / (224 * scale)
+}
+
+// halfToFloat32 converts an IEEE 754 half precision value to float32.
+func halfToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h) & 0x3ff
+
+	switch {
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal values are mant * 2^-24.
+		v := float32(mant) / (1 << 24)
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | mant<<13)
+}
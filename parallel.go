@@ -0,0 +1,172 @@
+package govship
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ParallelOptions configures ScoreFramesParallel.
+type ParallelOptions struct {
+	// Buffers is the number of frame pairs allocated for reading and
+	// scoring, which bounds memory use. Frames are read ahead while buffers
+	// are free. Defaults to twice the number of scorers.
+	Buffers int
+	// Pool provides the frame buffers. If nil, they are allocated for the
+	// call and left to the garbage collector.
+	Pool *FramePool
+	// ButteraugliNorms fills FrameScore.Butteraugli with every norm of
+	// the score. Every scorer must then implement ButteraugliFrameScorer.
+	ButteraugliNorms bool
+}
+
+// framePair is one buffer of the pool used by ScoreFramesParallel.
+type framePair struct {
+	index     int
+	ref, dist *Frame
+}
+
+// parallelResult is the outcome of one frame of ScoreFramesParallel. The
+// reader also reports the end of the sequence and read errors as results, so
+// that they are delivered in order after the frames before them.
+type parallelResult struct {
+	pair        *framePair
+	index       int
+	score       float64
+	butteraugli *ButteraugliScore
+	err         error
+	eof         bool
+}
+
+// ScoreFramesParallel scores every frame of a sequence with several
+// FrameScorers at once and passes the scores to yield in frame order.
+//
+// A reader goroutine decodes frame pairs into a fixed pool of buffers while
+// one worker goroutine per scorer computes scores, so reading and GPU work
+// overlap. Each scorer is only used by its own worker. Because the scorers
+// must not depend on previous frames, this suits SSIMU2 and Butteraugli
+// handlers created with the same configuration.
+//
+// yield is called from the calling goroutine. A buffer is recycled only after
+// its score has been yielded, so at most opts.Buffers frame pairs are in
+// memory. Processing stops at the first error from reading, scoring or yield,
+// and that error is returned. Every goroutine has exited when
+// ScoreFramesParallel returns, so the scorers can be closed right away.
+func ScoreFramesParallel(scorers []FrameScorer, ref, dist FrameSource,
+	opts ParallelOptions, yield func(FrameScore) error) error {
+	if len(scorers) == 0 {
+		return errors.New("at least one scorer is required")
+	}
+	if opts.Buffers <= 0 {
+		opts.Buffers = 2 * len(scorers)
+	}
+	if opts.ButteraugliNorms {
+		for _, scorer := range scorers {
+			if _, ok := scorer.(ButteraugliFrameScorer); !ok {
+				return errors.New("scorers must implement " +
+					"ButteraugliFrameScorer for Butteraugli norms")
+			}
+		}
+	}
+
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	free := make(chan *framePair, opts.Buffers)
+	pairs := make([]*framePair, opts.Buffers)
+	for i := range pairs {
+		pairs[i] = &framePair{ref: opts.Pool.Acquire(&refCS),
+			dist: opts.Pool.Acquire(&distCS)}
+		free <- pairs[i]
+	}
+	defer func() {
+		for _, pair := range pairs {
+			opts.Pool.Release(pair.ref)
+			opts.Pool.Release(pair.dist)
+		}
+	}()
+	jobs := make(chan *framePair, opts.Buffers)
+	results := make(chan parallelResult, opts.Buffers)
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	wg.Go(func() {
+		defer close(jobs)
+		for index := 0; ; index++ {
+			var pair *framePair
+			select {
+			case pair = <-free:
+			case <-done:
+				return
+			}
+			ok, err := readPair(ref, dist, pair.ref, pair.dist, index)
+			if err != nil || !ok {
+				select {
+				case results <- parallelResult{index: index, err: err,
+					eof: err == nil}:
+				case <-done:
+				}
+				return
+			}
+			pair.index = index
+			select {
+			case jobs <- pair:
+			case <-done:
+				return
+			}
+		}
+	})
+
+	for _, scorer := range scorers {
+		wg.Go(func() {
+			for pair := range jobs {
+				r := parallelResult{pair: pair, index: pair.index}
+				var code ExceptionCode
+				if opts.ButteraugliNorms {
+					var norms ButteraugliScore
+					norms, code = scorer.(ButteraugliFrameScorer).
+						ScoreButteraugliFrame(pair.ref, pair.dist)
+					r.score, r.butteraugli = norms.NormQ, &norms
+				} else {
+					r.score, code = scorer.ScoreFrame(pair.ref, pair.dist)
+				}
+				if !code.IsNone() {
+					r.err = fmt.Errorf("scoring frame %d: %w", pair.index,
+						code.Err())
+				}
+				select {
+				case results <- r:
+				case <-done:
+					return
+				}
+			}
+		})
+	}
+
+	pending := make(map[int]parallelResult)
+	for next := 0; ; {
+		r, ok := pending[next]
+		if !ok {
+			r = <-results
+			pending[r.index] = r
+			continue
+		}
+		delete(pending, next)
+		switch {
+		case r.eof:
+			return nil
+		case r.err != nil:
+			return r.err
+		}
+		err := yield(FrameScore{Index: next, Score: r.score,
+			Butteraugli: r.butteraugli})
+		free <- r.pair
+		if err != nil {
+			return err
+		}
+		next++
+	}
+}
@@ -0,0 +1,143 @@
+package govship_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// slowScorer scores like lumaScorer but takes longer on some frames, so that
+// parallel workers finish out of order.
+type slowScorer struct {
+	busy, peak *atomic.Int32
+}
+
+func (s slowScorer) ScoreFrame(ref, dist *vship.Frame) (float64,
+	vship.ExceptionCode) {
+	n := s.busy.Add(1)
+	defer s.busy.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	level := dist.Planes[0][0]
+	time.Sleep(time.Duration(level%4) * time.Millisecond)
+	return float64(level), vship.ExceptionCodeNoError
+}
+
+func Test_ScoreFramesParallel(t *testing.T) {
+	levels := make([]byte, 60)
+	for i := range levels {
+		levels[i] = byte(i * 7)
+	}
+	var busy, peak atomic.Int32
+	scorers := []vship.FrameScorer{slowScorer{&busy, &peak},
+		slowScorer{&busy, &peak}, slowScorer{&busy, &peak}}
+
+	var got []vship.FrameScore
+	err := vship.ScoreFramesParallel(scorers, grayFrames(16, 16, levels...),
+		grayFrames(16, 16, levels...), vship.ParallelOptions{},
+		func(f vship.FrameScore) error {
+			got = append(got, f)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(levels) {
+		t.Fatalf("got %d scores, want %d", len(got), len(levels))
+	}
+	for i, f := range got {
+		if f.Index != i || f.Score != float64(levels[i]) {
+			t.Fatalf("score %d = %+v, want index %d score %d", i, f, i,
+				levels[i])
+		}
+	}
+	if peak.Load() < 2 {
+		t.Fatalf("at most %d frames were scored at once", peak.Load())
+	}
+}
+
+func Test_ScoreFramesParallel_Errors(t *testing.T) {
+	levels := make([]byte, 30)
+	scorers := []vship.FrameScorer{&lumaScorer{}, &lumaScorer{}}
+
+	var count int
+	stop := errors.New("stop")
+	err := vship.ScoreFramesParallel(scorers, grayFrames(16, 16, levels...),
+		grayFrames(16, 16, levels...), vship.ParallelOptions{Buffers: 3},
+		func(f vship.FrameScore) error {
+			count++
+			if f.Index == 9 {
+				return stop
+			}
+			return nil
+		})
+	if err != stop || count != 10 {
+		t.Fatalf("err = %v after %d scores, want stop after 10", err, count)
+	}
+
+	// A length mismatch is reported after the frames before it.
+	count = 0
+	err = vship.ScoreFramesParallel(scorers, grayFrames(16, 16, levels...),
+		grayFrames(16, 16, levels[:12]...), vship.ParallelOptions{},
+		func(f vship.FrameScore) error {
+			count++
+			return nil
+		})
+	if err == nil || count != 12 {
+		t.Fatalf("err = %v after %d scores, want error after 12", err, count)
+	}
+}
+
+// normScorer reports Butteraugli norms derived from the distorted luma.
+type normScorer struct{}
+
+func (normScorer) ScoreFrame(ref, dist *vship.Frame) (float64,
+	vship.ExceptionCode) {
+	return float64(dist.Planes[0][0]), vship.ExceptionCodeNoError
+}
+
+func (normScorer) ScoreButteraugliFrame(ref, dist *vship.Frame) (
+	vship.ButteraugliScore, vship.ExceptionCode) {
+	level := float64(dist.Planes[0][0])
+	return vship.ButteraugliScore{NormQ: level, Norm3: 2 * level,
+		NormInf: 3 * level}, vship.ExceptionCodeNoError
+}
+
+func Test_ScoreFramesParallel_ButteraugliNorms(t *testing.T) {
+	levels := []byte{1, 2, 3, 4}
+	scorers := []vship.FrameScorer{normScorer{}, normScorer{}}
+	opts := vship.ParallelOptions{ButteraugliNorms: true}
+
+	var got []vship.FrameScore
+	err := vship.ScoreFramesParallel(scorers, grayFrames(16, 16, levels...),
+		grayFrames(16, 16, levels...), opts, func(f vship.FrameScore) error {
+			got = append(got, f)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range got {
+		level := float64(levels[i])
+		if b := f.Butteraugli; b == nil || f.Score != level ||
+			*b != (vship.ButteraugliScore{NormQ: level, Norm3: 2 * level,
+				NormInf: 3 * level}) {
+			t.Fatalf("frame %d = %+v", i, f)
+		}
+	}
+
+	err = vship.ScoreFramesParallel([]vship.FrameScorer{&lumaScorer{}},
+		grayFrames(16, 16, levels...), grayFrames(16, 16, levels...), opts,
+		func(vship.FrameScore) error { return nil })
+	if err == nil {
+		t.Fatal("scorers without norms should be rejected")
+	}
+}
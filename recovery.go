@@ -0,0 +1,242 @@
+package govship
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// RecoveryOptions configures a ResilientScorer.
+type RecoveryOptions struct {
+	// Retries is the number of times a frame is retried on the same device
+	// after freeing the idle handlers of the pool. Defaults to 1.
+	Retries int
+	// Devices lists other GPUs to move the work to, in order, when the
+	// current device keeps running out of memory.
+	Devices []int
+	// Downscale allows scoring at a reduced resolution as a last resort. The
+	// TargetWidth and TargetHeight of both Colorspaces are reduced step by
+	// step until the handler fits or MinHeight is reached.
+	Downscale bool
+	// DownscaleStep is the factor applied to the resolution at each step.
+	// Defaults to 0.75.
+	DownscaleStep float64
+	// MinHeight is the smallest height downscaling may reach. Defaults to
+	// 360.
+	MinHeight int
+}
+
+// RecoveredScore is the score of a frame together with the fallbacks that
+// were needed to compute it.
+type RecoveredScore struct {
+	Score float64
+	// Butteraugli holds every norm of the score of a Butteraugli handler,
+	// whose NormQ is Score. It is nil for other metrics.
+	Butteraugli *ButteraugliScore
+	// Retries is the number of attempts that failed for lack of memory
+	// before the score was computed.
+	Retries int
+	// Device is the GPU the score was computed on.
+	Device int
+	// Moved reports that the work runs on another device than requested.
+	Moved bool
+	// Downscaled reports that the frame was scored at the reduced
+	// resolution TargetWidth x TargetHeight instead of the requested one.
+	Downscaled                bool
+	TargetWidth, TargetHeight int64
+}
+
+// Fallback reports whether the score was computed differently than
+// requested, on another device or at a lower resolution.
+func (r RecoveredScore) Fallback() bool { return r.Moved || r.Downscaled }
+
+// ResilientScorer scores frames with a SSIMU2 or Butteraugli handler from a
+// HandlerPool and recovers from running out of device or host memory.
+//
+// When creating the handler or scoring a frame fails with
+// ExceptionCodeOutOfVRAM or ExceptionCodeOutOfRAM, the idle handlers of the
+// pool are freed and the frame is retried. If that is not enough the work
+// moves to the next device of RecoveryOptions.Devices and finally, if
+// allowed, to a reduced resolution. Fallbacks are kept for the following
+// frames, so a long sequence does not fail on every frame, and every
+// RecoveredScore records which fallback produced it.
+type ResilientScorer struct {
+	pool      *HandlerPool
+	opts      RecoveryOptions
+	requested HandlerSpec
+	spec      HandlerSpec
+	handler   Handler
+	devices   []int // devices not tried yet
+}
+
+// NewResilientScorer creates a ResilientScorer for handlers described by
+// spec. The handler is obtained from pool on the first frame.
+func NewResilientScorer(pool *HandlerPool, spec HandlerSpec,
+	opts RecoveryOptions) *ResilientScorer {
+	if opts.Retries <= 0 {
+		opts.Retries = 1
+	}
+	if opts.DownscaleStep <= 0 || opts.DownscaleStep >= 1 {
+		opts.DownscaleStep = 0.75
+	}
+	if opts.MinHeight <= 0 {
+		opts.MinHeight = 360
+	}
+	devices := slices.DeleteFunc(slices.Clone(opts.Devices),
+		func(d int) bool { return d == spec.Device })
+	return &ResilientScorer{pool: pool, opts: opts, requested: spec,
+		spec: spec, devices: devices}
+}
+
+// Spec returns the handler description currently in use, including any
+// change of device or resolution made by a fallback.
+func (s *ResilientScorer) Spec() HandlerSpec { return s.spec }
+
+// Score computes the score of a pair of frames, recovering from memory
+// exhaustion as described on ResilientScorer. Errors other than running out
+// of memory are returned as they are.
+func (s *ResilientScorer) Score(ref, dist *Frame) (RecoveredScore, error) {
+	var result RecoveredScore
+	retries := 0
+	for {
+		score, butteraugli, code := s.attempt(ref, dist)
+		if code.IsNone() {
+			result.Score, result.Butteraugli = score, butteraugli
+			break
+		}
+		if code != ExceptionCodeOutOfVRAM && code != ExceptionCodeOutOfRAM {
+			return result, code.Err()
+		}
+
+		result.Retries++
+		switch {
+		case retries < s.opts.Retries:
+			retries++
+			s.pool.FreeIdle()
+		case len(s.devices) > 0:
+			retries = 0
+			s.dropHandler()
+			s.spec.Device, s.devices = s.devices[0], s.devices[1:]
+		case s.opts.Downscale && s.downscale():
+			retries = 0
+			s.dropHandler()
+		default:
+			return result, fmt.Errorf("no fallback left after %d "+
+				"attempts: %w", result.Retries, code.Err())
+		}
+	}
+
+	result.Device = s.spec.Device
+	result.Moved = s.spec.Device != s.requested.Device
+	result.TargetWidth = s.spec.Source.TargetWidth
+	result.TargetHeight = s.spec.Source.TargetHeight
+	result.Downscaled = s.spec.Source != s.requested.Source
+	return result, nil
+}
+
+// ScoreFrame implements FrameScorer.
+func (s *ResilientScorer) ScoreFrame(ref, dist *Frame) (float64,
+	ExceptionCode) {
+	result, err := s.Score(ref, dist)
+	if err != nil {
+		return 0, exceptionCode(err)
+	}
+	return result.Score, ExceptionCodeNoError
+}
+
+// ScoreButteraugliFrame implements ButteraugliFrameScorer. It fails with
+// ExceptionCodeBadHandler unless the scorer uses a Butteraugli handler.
+func (s *ResilientScorer) ScoreButteraugliFrame(ref, dist *Frame) (
+	ButteraugliScore, ExceptionCode) {
+	if s.spec.Metric != MetricButteraugli {
+		return ButteraugliScore{}, ExceptionCodeBadHandler
+	}
+	result, err := s.Score(ref, dist)
+	if err != nil {
+		return ButteraugliScore{}, exceptionCode(err)
+	}
+	if result.Butteraugli == nil {
+		return ButteraugliScore{NormQ: result.Score}, ExceptionCodeNoError
+	}
+	return *result.Butteraugli, ExceptionCodeNoError
+}
+
+// exceptionCode returns the code of the *Exception wrapped by err, or
+// ExceptionCodeBadHandler if it wraps none.
+func exceptionCode(err error) ExceptionCode {
+	var exc *Exception
+	if !errors.As(err, &exc) {
+		return ExceptionCodeBadHandler
+	}
+	return exc.Code
+}
+
+// Close returns the handler to the pool.
+func (s *ResilientScorer) Close() {
+	if s.handler != nil {
+		s.pool.Put(s.spec, s.handler)
+		s.handler = nil
+	}
+}
+
+// attempt scores a frame with the current handler, creating it first if
+// needed. Handlers implementing ButteraugliFrameScorer also report every
+// norm.
+func (s *ResilientScorer) attempt(ref, dist *Frame) (float64,
+	*ButteraugliScore, ExceptionCode) {
+	if s.handler == nil {
+		h, code := s.pool.Get(s.spec)
+		if !code.IsNone() {
+			return 0, nil, code
+		}
+		s.handler = h
+	}
+	scorer, ok := s.handler.(FrameScorer)
+	if !ok {
+		return 0, nil, ExceptionCodeBadHandler
+	}
+
+	var score float64
+	var butteraugli *ButteraugliScore
+	code := withDevice(s.spec.Device, func() ExceptionCode {
+		b, ok := scorer.(ButteraugliFrameScorer)
+		if !ok {
+			var code ExceptionCode
+			score, code = scorer.ScoreFrame(ref, dist)
+			return code
+		}
+		norms, code := b.ScoreButteraugliFrame(ref, dist)
+		score, butteraugli = norms.NormQ, &norms
+		return code
+	})
+	return score, butteraugli, code
+}
+
+// dropHandler discards the current handler before the spec changes.
+func (s *ResilientScorer) dropHandler() {
+	if s.handler != nil {
+		s.pool.Discard(s.handler)
+		s.handler = nil
+	}
+	s.pool.FreeIdle()
+}
+
+// downscale reduces the target resolution of the spec by one step. It
+// returns false once the minimum height is reached.
+func (s *ResilientScorer) downscale() bool {
+	width, height := s.spec.Source.outputSize()
+	newHeight := evenRound(float64(height) * s.opts.DownscaleStep)
+	if newHeight < s.opts.MinHeight {
+		return false
+	}
+	newWidth := evenRound(float64(width) * s.opts.DownscaleStep)
+	s.spec.Source.TargetWidth = int64(newWidth)
+	s.spec.Source.TargetHeight = int64(newHeight)
+	s.spec.Distorted.TargetWidth = int64(newWidth)
+	s.spec.Distorted.TargetHeight = int64(newHeight)
+	return true
+}
+
+// evenRound rounds v to the nearest even integer.
+func evenRound(v float64) int { return 2 * int(math.Round(v/2)) }
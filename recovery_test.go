@@ -0,0 +1,92 @@
+package govship_test
+
+import (
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_ResilientScorer_Downscale(t *testing.T) {
+	var created, closed int
+	pool := fakePool(1280*720, &created, &closed)
+	spec := vship.HandlerSpec{Metric: vship.MetricSSIMU2}
+	spec.Source.SetDefaults(1920, 1080, vship.SamplingFormatUInt8)
+	spec.Distorted = spec.Source
+
+	scorer := vship.NewResilientScorer(pool, spec, vship.RecoveryOptions{
+		Downscale: true})
+	defer scorer.Close()
+	frames := grayFrames(16, 16, 0)
+	frame := vship.NewFrame(&frames.cs)
+
+	result, err := scorer.Score(frame, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1920x1080 -> 1440x810 -> 1080x608, with one retry at each size that
+	// does not fit.
+	if !result.Downscaled || !result.Fallback() ||
+		result.TargetWidth != 1080 || result.TargetHeight != 608 {
+		t.Fatalf("result = %+v, want downscaled to 1080x608", result)
+	}
+	if result.Retries != 4 || result.Score != 1080*608 {
+		t.Fatalf("result = %+v, want 4 failed attempts", result)
+	}
+
+	// The fallback sticks for the next frames.
+	created = 0
+	result, err = scorer.Score(frame, frame)
+	if err != nil || result.Retries != 0 || !result.Downscaled ||
+		created != 0 {
+		t.Fatalf("second frame: %+v, %v, %d handlers created", result, err,
+			created)
+	}
+
+	// Without downscaling the memory error is returned.
+	scorer = vship.NewResilientScorer(pool, spec, vship.RecoveryOptions{})
+	if _, code := scorer.ScoreFrame(frame, frame); code !=
+		vship.ExceptionCodeOutOfVRAM {
+		t.Fatalf("code = %v, want OutOfVRAM", code)
+	}
+}
+
+// fakeButteraugliHandler is a fakeHandler reporting every Butteraugli norm.
+type fakeButteraugliHandler struct{ fakeHandler }
+
+func (h *fakeButteraugliHandler) ScoreButteraugliFrame(ref,
+	dist *vship.Frame) (vship.ButteraugliScore, vship.ExceptionCode) {
+	score, code := h.ScoreFrame(ref, dist)
+	return vship.ButteraugliScore{NormQ: score, Norm3: score + 1,
+		NormInf: score + 2}, code
+}
+
+func Test_ResilientScorer_ButteraugliNorms(t *testing.T) {
+	var closed int
+	pool := vship.NewHandlerPool(vship.HandlerPoolOptions{
+		New: func(spec vship.HandlerSpec) (vship.Handler,
+			vship.ExceptionCode) {
+			return &fakeButteraugliHandler{fakeHandler{pixels: 1,
+				limit: 1, closed: &closed}}, vship.ExceptionCodeNoError
+		}})
+	spec := vship.HandlerSpec{Metric: vship.MetricButteraugli}
+	spec.Source.SetDefaults(16, 16, vship.SamplingFormatUInt8)
+	spec.Distorted = spec.Source
+	frames := grayFrames(16, 16, 0)
+	frame := vship.NewFrame(&frames.cs)
+
+	scorer := vship.NewResilientScorer(pool, spec, vship.RecoveryOptions{})
+	defer scorer.Close()
+	score, code := scorer.ScoreButteraugliFrame(frame, frame)
+	if !code.IsNone() || score != (vship.ButteraugliScore{NormQ: 1,
+		Norm3: 2, NormInf: 3}) {
+		t.Fatalf("score = %+v, %v", score, code)
+	}
+
+	spec.Metric = vship.MetricSSIMU2
+	other := vship.NewResilientScorer(pool, spec, vship.RecoveryOptions{})
+	defer other.Close()
+	if _, code := other.ScoreButteraugliFrame(frame, frame); code !=
+		vship.ExceptionCodeBadHandler {
+		t.Fatalf("code = %v for SSIMU2, want BadHandler", code)
+	}
+}
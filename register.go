@@ -0,0 +1,370 @@
+package govship
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+// Registration describes the geometric relation between a reference frame and
+// a shifted or rescaled distorted frame: the reference pixel (x, y) appears
+// at (Scale*x + OffsetX, Scale*y + OffsetY) in the distorted frame. All
+// coordinates are in pixels of the uncropped images.
+type Registration struct {
+	Scale            float64
+	OffsetX, OffsetY float64
+	// Residual is the mean absolute luma difference, between 0 and 1, of
+	// the two frames once registered. Large values mean the estimate is
+	// unreliable.
+	Residual float64
+}
+
+// RegistrationOptions configures EstimateRegistration.
+type RegistrationOptions struct {
+	// MaxShift is the largest translation searched, in distorted pixels.
+	// Defaults to 32.
+	MaxShift int
+	// MaxScaleError is the largest relative deviation searched around a
+	// scale of 1 and around the ratio of the frame widths. Defaults to 0.05.
+	MaxScaleError float64
+	// Frames is the number of frames RegisterSources estimates on. The
+	// estimate with the lowest residual is used. Defaults to 5.
+	Frames int
+}
+
+// registrationImage is a luma image sampled every step pixels, addressed in
+// pixels of the uncropped full resolution image.
+type registrationImage struct {
+	width, height, step int
+	pix                 []float32
+}
+
+func newRegistrationImage(cs *Colorspace, frame *Frame, step int,
+) (*registrationImage, error) {
+	probe := *cs
+	probe.CropTop, probe.CropBottom, probe.CropLeft, probe.CropRight = 0, 0,
+		0, 0
+	width, height, luma, err := readLuma(&probe, frame.Planes, frame.LineSize,
+		step)
+	if err != nil {
+		return nil, err
+	}
+	return &registrationImage{width, height, step, luma}, nil
+}
+
+// sample returns the bilinearly interpolated luma at full resolution position
+// (x, y) and whether the position lies inside the image.
+func (img *registrationImage) sample(x, y float64) (float32, bool) {
+	fx, fy := x/float64(img.step), y/float64(img.step)
+	if fx < 0 || fy < 0 || fx > float64(img.width-1) ||
+		fy > float64(img.height-1) {
+		return 0, false
+	}
+	x0, y0 := int(fx), int(fy)
+	x1, y1 := min(x0+1, img.width-1), min(y0+1, img.height-1)
+	ax, ay := float32(fx-float64(x0)), float32(fy-float64(y0))
+
+	top := img.pix[y0*img.width+x0]*(1-ax) + img.pix[y0*img.width+x1]*ax
+	bottom := img.pix[y1*img.width+x0]*(1-ax) + img.pix[y1*img.width+x1]*ax
+	return top*(1-ay) + bottom*ay, true
+}
+
+// registrationCost returns the mean absolute difference between ref and dist
+// under the given registration, visiting every stride-th sample of ref. At
+// least half of the visited samples must land inside dist, otherwise +Inf
+// is returned.
+func registrationCost(ref, dist *registrationImage, r Registration,
+	stride int) float64 {
+	var sum float64
+	var inside, total int
+	for y := 0; y < ref.height; y += stride {
+		fy := float64(y*ref.step)*r.Scale + r.OffsetY
+		for x := 0; x < ref.width; x += stride {
+			total++
+			v, ok := dist.sample(float64(x*ref.step)*r.Scale+r.OffsetX, fy)
+			if !ok {
+				continue
+			}
+			sum += math.Abs(float64(ref.pix[y*ref.width+x] - v))
+			inside++
+		}
+	}
+	if inside == 0 || inside*2 < total {
+		return math.Inf(1)
+	}
+	return sum / float64(inside)
+}
+
+// EstimateRegistration estimates the translation and scale that map a
+// reference frame onto a distorted frame, for encodes that were cropped by a
+// few pixels, rescaled, or both.
+//
+// The search runs coarse to fine on luma: an exhaustive search over integer
+// shifts and a grid of scales on decimated frames, a refinement at full
+// resolution, and a parabolic fit of the cost around the best candidate for
+// subpixel precision.
+func EstimateRegistration(refCS *Colorspace, ref *Frame, distCS *Colorspace,
+	dist *Frame, opts RegistrationOptions) (Registration, error) {
+	if opts.MaxShift <= 0 {
+		opts.MaxShift = 32
+	}
+	if opts.MaxScaleError <= 0 {
+		opts.MaxScaleError = 0.05
+	}
+
+	const analysisWidth = 256
+	coarse := max(int(refCS.Width)/analysisWidth, 1)
+	refCoarse, err := newRegistrationImage(refCS, ref, coarse)
+	if err != nil {
+		return Registration{}, err
+	}
+	distCoarse, err := newRegistrationImage(distCS, dist, coarse)
+	if err != nil {
+		return Registration{}, err
+	}
+
+	// Candidate scales around 1 (cropped) and around the size ratio
+	// (rescaled).
+	var scales []float64
+	ratio := float64(distCS.Width) / float64(refCS.Width)
+	for _, center := range []float64{1, ratio} {
+		for k := -10; k <= 10; k++ {
+			scales = append(scales, center*(1+opts.MaxScaleError*
+				float64(k)/10))
+		}
+	}
+
+	best := Registration{Residual: math.Inf(1)}
+	shift := float64(opts.MaxShift)
+	for _, s := range scales {
+		for ty := -shift; ty <= shift; ty += float64(coarse) {
+			for tx := -shift; tx <= shift; tx += float64(coarse) {
+				r := Registration{s, tx, ty, 0}
+				if c := registrationCost(refCoarse, distCoarse, r, 2); c <
+					best.Residual {
+					best, best.Residual = r, c
+				}
+			}
+		}
+	}
+	if math.IsInf(best.Residual, 1) {
+		return Registration{}, errors.New("frames do not overlap within " +
+			"the searched range")
+	}
+
+	refFull, err := newRegistrationImage(refCS, ref, 1)
+	if err != nil {
+		return Registration{}, err
+	}
+	distFull, err := newRegistrationImage(distCS, dist, 1)
+	if err != nil {
+		return Registration{}, err
+	}
+	stride := max(int(refCS.Width)/analysisWidth, 1)
+	cost := func(r Registration) float64 {
+		return registrationCost(refFull, distFull, r, stride)
+	}
+
+	// Refine on whole pixels and fine scale steps around the coarse result.
+	center := best
+	best.Residual = cost(best)
+	scaleStep := best.Scale * opts.MaxScaleError / 40
+	for ks := -4; ks <= 4; ks++ {
+		for dy := -coarse; dy <= coarse; dy++ {
+			for dx := -coarse; dx <= coarse; dx++ {
+				r := Registration{center.Scale + float64(ks)*scaleStep,
+					center.OffsetX + float64(dx), center.OffsetY + float64(dy),
+					0}
+				if c := cost(r); c < best.Residual {
+					best, best.Residual = r, c
+				}
+			}
+		}
+	}
+
+	// Subpixel refinement, one parameter at a time.
+	best.OffsetX = parabolicMinimum(best.OffsetX, 1, func(v float64) float64 {
+		r := best
+		r.OffsetX = v
+		return cost(r)
+	})
+	best.OffsetY = parabolicMinimum(best.OffsetY, 1, func(v float64) float64 {
+		r := best
+		r.OffsetY = v
+		return cost(r)
+	})
+	best.Scale = parabolicMinimum(best.Scale, scaleStep,
+		func(v float64) float64 {
+			r := best
+			r.Scale = v
+			return cost(r)
+		})
+	best.Residual = cost(best)
+	return best, nil
+}
+
+// parabolicMinimum fits a parabola through f at x-h, x and x+h and returns
+// the position of its minimum, limited to [x-h, x+h]. x is returned when the
+// samples do not form a valley.
+func parabolicMinimum(x, h float64, f func(float64) float64) float64 {
+	left, mid, right := f(x-h), f(x), f(x+h)
+	denom := left - 2*mid + right
+	if denom <= 0 || math.IsInf(left, 0) || math.IsInf(right, 0) {
+		return x
+	}
+	offset := (left - right) / (2 * denom)
+	return x + min(max(offset, -1), 1)*h
+}
+
+// Apply restricts ref and dist to the area they have in common and resizes
+// dist to match ref, so both inputs are registered before scoring.
+//
+// The crop rectangles of both Colorspaces are replaced and the TargetWidth
+// and TargetHeight of dist are set to the output size of ref. Crop edges are
+// rounded to whole pixels aligned to the chroma subsampling, so subpixel
+// offsets are only approximated. ref and dist must be uncropped.
+func (r Registration) Apply(ref, dist *Colorspace) error {
+	if r.Scale <= 0 {
+		return errors.New("registration scale must be positive")
+	}
+
+	refAlignW, refAlignH := cropAlignment(ref)
+	distAlignW, distAlignH := cropAlignment(dist)
+
+	// region returns the aligned reference interval [lo, hi) visible in
+	// the distorted frame along one axis, and the matching distorted
+	// interval.
+	region := func(refSize, distSize int64, offset float64, refAlign,
+		distAlign int) (lo, hi, dlo, dhi int) {
+		lo = int(math.Round(max(0, -offset/r.Scale)))
+		hi = int(math.Round(min(float64(refSize),
+			(float64(distSize)-offset)/r.Scale)))
+		lo = (lo + refAlign - 1) / refAlign * refAlign
+		hi = hi / refAlign * refAlign
+
+		round := func(v float64) int {
+			return int(math.Round(v/float64(distAlign))) * distAlign
+		}
+		dlo = max(round(float64(lo)*r.Scale+offset), 0)
+		dhi = min(round(float64(hi)*r.Scale+offset), int(distSize))
+		return lo, hi, dlo, dhi
+	}
+
+	x0, x1, dx0, dx1 := region(ref.Width, dist.Width, r.OffsetX, refAlignW,
+		distAlignW)
+	y0, y1, dy0, dy1 := region(ref.Height, dist.Height, r.OffsetY, refAlignH,
+		distAlignH)
+	if x1 <= x0 || y1 <= y0 || dx1 <= dx0 || dy1 <= dy0 {
+		return errors.New("registered frames do not overlap")
+	}
+
+	ref.CropLeft, ref.CropRight = x0, int(ref.Width)-x1
+	ref.CropTop, ref.CropBottom = y0, int(ref.Height)-y1
+	dist.CropLeft, dist.CropRight = dx0, int(dist.Width)-dx1
+	dist.CropTop, dist.CropBottom = dy0, int(dist.Height)-dy1
+
+	width, height := ref.outputSize()
+	dist.TargetWidth, dist.TargetHeight = int64(width), int64(height)
+	return nil
+}
+
+// cropAlignment returns the granularity crop edges must respect so they do
+// not split chroma samples.
+func cropAlignment(cs *Colorspace) (int, int) {
+	if cs.ColorFamily == ColorFamilyRGB {
+		return 1, 1
+	}
+	return 1 << cs.ChromaSubsamplingWidth, 1 << cs.ChromaSubsamplingHeight
+}
+
+// RegisterSources estimates the registration of dist relative to ref and
+// returns sources whose Colorspace has the registration applied, so handlers
+// created from them score the registered area directly.
+//
+// The estimate is computed on frames spread over the first opts.Frames * 10
+// frames of the sequence; the one with the lowest residual is kept. Both
+// sources are rewound before the wrapped sources are returned.
+func RegisterSources(ref, dist RewindableFrameSource,
+	opts RegistrationOptions) (FrameSource, FrameSource, Registration,
+	error) {
+	if opts.Frames <= 0 {
+		opts.Frames = 5
+	}
+
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	refFrame, distFrame := NewFrame(&refCS), NewFrame(&distCS)
+
+	var estimates []Registration
+	for index := 0; len(estimates) < opts.Frames; index++ {
+		ok, err := readPair(ref, dist, refFrame, distFrame, index)
+		if err != nil {
+			return nil, nil, Registration{}, err
+		}
+		if !ok {
+			break
+		}
+		if index%10 != 0 {
+			continue
+		}
+		r, err := EstimateRegistration(&refCS, refFrame, &distCS, distFrame,
+			opts)
+		if err != nil {
+			return nil, nil, Registration{}, err
+		}
+		estimates = append(estimates, r)
+	}
+	if len(estimates) == 0 {
+		return nil, nil, Registration{}, errors.New("no frames to register")
+	}
+	if err := rewind(ref, dist); err != nil {
+		return nil, nil, Registration{}, err
+	}
+
+	best := slices.MinFunc(estimates, func(a, b Registration) int {
+		switch {
+		case a.Residual < b.Residual:
+			return -1
+		case a.Residual > b.Residual:
+			return 1
+		}
+		return 0
+	})
+	if err := best.Apply(&refCS, &distCS); err != nil {
+		return nil, nil, Registration{}, err
+	}
+	return &registeredSource{ref, refCS}, &registeredSource{dist, distCS},
+		best, nil
+}
+
+// registeredSource reports a Colorspace with a registration applied while
+// delivering the frames of the wrapped source unchanged.
+type registeredSource struct {
+	FrameSource
+	cs Colorspace
+}
+
+func (s *registeredSource) Colorspace() Colorspace { return s.cs }
+
+func (s *registeredSource) Rewind() error {
+	r, ok := s.FrameSource.(RewindableFrameSource)
+	if !ok {
+		return errors.New("underlying frame source cannot be rewound")
+	}
+	return r.Rewind()
+}
+
+// Register registers dist against ref with RegisterSources and sets the
+// Source and Distorted colorspaces of s to the registered ones, so handlers
+// created from s afterwards, directly or by the scoring helpers, score the
+// registered area. The returned sources deliver the frames of ref and dist
+// and are the ones to score.
+func (s *HandlerSpec) Register(ref, dist RewindableFrameSource,
+	opts RegistrationOptions) (FrameSource, FrameSource, Registration,
+	error) {
+	refSrc, distSrc, r, err := RegisterSources(ref, dist, opts)
+	if err != nil {
+		return nil, nil, Registration{}, err
+	}
+	s.Source, s.Distorted = refSrc.Colorspace(), distSrc.Colorspace()
+	return refSrc, distSrc, r, nil
+}
@@ -0,0 +1,100 @@
+package govship_test
+
+import (
+	"math"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// texturedFrame returns an 8-bit full range RGB frame with a smooth,
+// non-periodic pattern. The value at (x, y) is pattern(x*scale+dx, y*scale+dy).
+func texturedFrame(width, height int64, scale, dx, dy float64) (
+	vship.Colorspace, *vship.Frame) {
+	var cs vship.Colorspace
+	cs.SetDefaults(width, height, vship.SamplingFormatUInt8)
+	cs.ColorFamily = vship.ColorFamilyRGB
+	cs.ColorRange = vship.ColorRangeFull
+
+	frame := vship.NewFrame(&cs)
+	for y := range int(height) {
+		for x := range int(width) {
+			fx, fy := float64(x)*scale+dx, float64(y)*scale+dy
+			v := 128 + 60*math.Sin(fx*0.11+2*math.Sin(fy*0.05)) +
+				40*math.Cos(fy*0.13+fx*0.02)
+			for i := range frame.Planes {
+				frame.Planes[i][y*int(width)+x] = byte(v)
+			}
+		}
+	}
+	return cs, frame
+}
+
+func Test_EstimateRegistration(t *testing.T) {
+	refCS, ref := texturedFrame(160, 120, 1, 0, 0)
+
+	// The distorted frame starts 6 pixels right and 4 pixels down into the
+	// reference, as after cropping.
+	distCS, dist := texturedFrame(148, 112, 1, 6, 4)
+	r, err := vship.EstimateRegistration(&refCS, ref, &distCS, dist,
+		vship.RegistrationOptions{MaxShift: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(r.Scale-1) > 0.005 || math.Abs(r.OffsetX+6) > 0.5 ||
+		math.Abs(r.OffsetY+4) > 0.5 {
+		t.Fatalf("crop registration = %+v, want scale 1 offset (-6, -4)", r)
+	}
+
+	if err := r.Apply(&refCS, &distCS); err != nil {
+		t.Fatal(err)
+	}
+	if refCS.CropLeft != 6 || refCS.CropTop != 4 || distCS.CropLeft != 0 ||
+		distCS.TargetWidth != 148 || distCS.TargetHeight != 112 {
+		t.Fatalf("Apply gave ref crop (%d, %d), dist crop %d target %dx%d",
+			refCS.CropLeft, refCS.CropTop, distCS.CropLeft,
+			distCS.TargetWidth, distCS.TargetHeight)
+	}
+
+	// The distorted frame is the reference downscaled by 2.
+	refCS, ref = texturedFrame(160, 120, 1, 0, 0)
+	distCS, dist = texturedFrame(80, 60, 2, 0, 0)
+	r, err = vship.EstimateRegistration(&refCS, ref, &distCS, dist,
+		vship.RegistrationOptions{MaxShift: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(r.Scale-0.5) > 0.005 || math.Abs(r.OffsetX) > 0.5 ||
+		math.Abs(r.OffsetY) > 0.5 {
+		t.Fatalf("scale registration = %+v, want scale 0.5", r)
+	}
+}
+
+func Test_HandlerSpec_Register(t *testing.T) {
+	refCS, refFrame := texturedFrame(160, 120, 1, 0, 0)
+	distCS, distFrame := texturedFrame(148, 112, 1, 6, 4)
+	ref := &memorySource{cs: refCS, frames: []*vship.Frame{refFrame}}
+	dist := &memorySource{cs: distCS, frames: []*vship.Frame{distFrame}}
+
+	spec := vship.HandlerSpec{Metric: vship.MetricSSIMU2, Source: refCS,
+		Distorted: distCS}
+	refSrc, distSrc, _, err := spec.Register(ref, dist,
+		vship.RegistrationOptions{MaxShift: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Source != refSrc.Colorspace() ||
+		spec.Distorted != distSrc.Colorspace() {
+		t.Fatal("spec does not hold the registered colorspaces")
+	}
+	if spec.Source.CropLeft != 6 || spec.Source.CropTop != 4 ||
+		spec.Distorted.TargetWidth != 148 {
+		t.Fatalf("registered spec %+v", spec)
+	}
+
+	// The registered sources start from the first frame.
+	frame := vship.NewFrame(&refCS)
+	if err := refSrc.ReadFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+}
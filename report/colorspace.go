@@ -0,0 +1,93 @@
+package report
+
+import (
+	"strconv"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// Names of the colorspace enumerations as written in reports. The govship
+// command takes its colorspace overrides from the same tables, so reports
+// and flags use one set of names.
+var (
+	SamplingFormatNames = map[vship.SamplingFormat]string{
+		vship.SamplingFormatFloat:  "float",
+		vship.SamplingFormatHalf:   "half",
+		vship.SamplingFormatUInt8:  "uint8",
+		vship.SamplingFormatUInt9:  "uint9",
+		vship.SamplingFormatUInt10: "uint10",
+		vship.SamplingFormatUInt12: "uint12",
+		vship.SamplingFormatUInt14: "uint14",
+		vship.SamplingFormatUInt16: "uint16",
+	}
+	ColorRangeNames = map[vship.ColorRange]string{
+		vship.ColorRangeLimited: "limited",
+		vship.ColorRangeFull:    "full",
+	}
+	ColorFamilyNames = map[vship.ColorFamily]string{
+		vship.ColorFamilyYUV: "yuv",
+		vship.ColorFamilyRGB: "rgb",
+	}
+	ChromaLocationNames = map[vship.ChromaLocation]string{
+		vship.ChromaLocationLeft:    "left",
+		vship.ChromaLocationCenter:  "center",
+		vship.ChromaLocationTopLeft: "topleft",
+		vship.ChromaLocationTop:     "top",
+	}
+	MatrixNames = map[vship.ColorMatrix]string{
+		vship.ColorMatrixRGB:         "rgb",
+		vship.ColorMatrixBT709:       "bt709",
+		vship.ColorMatrixBT470BG:     "bt470bg",
+		vship.ColorMatrixST170M:      "st170m",
+		vship.ColorMatrixBT2020NCL:   "bt2020ncl",
+		vship.ColorMatrixBT2020CL:    "bt2020cl",
+		vship.ColorMatrixBT2100ICTCP: "ictcp",
+	}
+	TransferNames = map[vship.ColorTransfer]string{
+		vship.ColorTransferTRCBT709:    "bt709",
+		vship.ColorTransferTRCBT470_M:  "bt470m",
+		vship.ColorTransferTRCBT470_BG: "bt470bg",
+		vship.ColorTransferTRCBT601:    "bt601",
+		vship.ColorTransferTRCLinear:   "linear",
+		vship.ColorTransferTRCSRGB:     "srgb",
+		vship.ColorTransferTRCPQ:       "pq",
+		vship.ColorTransferTRCST428:    "st428",
+		vship.ColorTransferTRCHLG:      "hlg",
+	}
+	PrimariesNames = map[vship.ColorPrimaries]string{
+		vship.ColorPrimariesINTERNAL: "internal",
+		vship.ColorPrimariesBT709:    "bt709",
+		vship.ColorPrimariesBT470_M:  "bt470m",
+		vship.ColorPrimariesBT470_BG: "bt470bg",
+		vship.ColorPrimariesBT2020:   "bt2020",
+	}
+)
+
+// name returns the name of v, or its number for values without one.
+func name[T ~int](names map[T]string, v T) string {
+	if n, ok := names[v]; ok {
+		return n
+	}
+	return strconv.Itoa(int(v))
+}
+
+// NewColorspace describes cs.
+func NewColorspace(cs vship.Colorspace) Colorspace {
+	return Colorspace{
+		Width:          cs.Width,
+		Height:         cs.Height,
+		TargetWidth:    cs.TargetWidth,
+		TargetHeight:   cs.TargetHeight,
+		SamplingFormat: name(SamplingFormatNames, cs.SamplingFormat),
+		ColorRange:     name(ColorRangeNames, cs.ColorRange),
+		ColorFamily:    name(ColorFamilyNames, cs.ColorFamily),
+		ChromaSubsampling: [2]int{cs.ChromaSubsamplingWidth,
+			cs.ChromaSubsamplingHeight},
+		ChromaLocation: name(ChromaLocationNames, cs.ChromaLocation),
+		Matrix:         name(MatrixNames, cs.ColorMatrix),
+		Transfer:       name(TransferNames, cs.ColorTransfer),
+		Primaries:      name(PrimariesNames, cs.ColorPrimaries),
+		Crop: [4]int{cs.CropTop, cs.CropBottom, cs.CropLeft,
+			cs.CropRight},
+	}
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Columns written by WriteCSV and WriteAggregateCSV. Every row carries the
+// schema version and metric so rows of several reports can be concatenated.
+var (
+	frameColumns = []string{"schema_version", "metric", "frame", "score",
+		"norm_q", "norm_3", "norm_inf"}
+	aggregateColumns = []string{"schema_version", "metric", "statistic",
+		"value"}
+)
+
+// formatFloat formats scores with the shortest exact representation.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteCSV writes one row per frame with the columns schema_version, metric,
+// frame, score, norm_q, norm_3 and norm_inf. The Butteraugli norms are empty
+// for other metrics.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(frameColumns)
+	version := strconv.Itoa(r.SchemaVersion)
+	for _, f := range r.Frames {
+		row := []string{version, r.Metric, strconv.Itoa(f.Index),
+			formatFloat(f.Score), "", "", ""}
+		if b := f.Butteraugli; b != nil {
+			row[4], row[5], row[6] = formatFloat(b.NormQ),
+				formatFloat(b.Norm3), formatFloat(b.NormInf)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteAggregateCSV writes one row per statistic with the columns
+// schema_version, metric, statistic and value: the aggregate statistics,
+// the worst frames as "worst_<rank>_frame" and "worst_<rank>_score", and
+// the sequence score as "sequence_score", whichever the report holds.
+// Undefined statistics are left out.
+func (r *Report) WriteAggregateCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(aggregateColumns)
+	version := strconv.Itoa(r.SchemaVersion)
+	write := func(statistic string, value float64) {
+		cw.Write([]string{version, r.Metric, statistic, formatFloat(value)})
+	}
+
+	if a := r.Aggregate; a != nil {
+		write("count", float64(a.Count))
+		for _, stat := range []struct {
+			name  string
+			value *float64
+		}{{"mean", &a.Mean}, {"harmonic_mean", a.HarmonicMean},
+			{"median", &a.Median}, {"stddev", &a.StdDev}, {"min", a.Min},
+			{"max", a.Max}, {"p1", &a.P1}, {"p5", &a.P5}, {"p95", &a.P95}} {
+			if stat.value != nil {
+				write(stat.name, *stat.value)
+			}
+		}
+		for i, f := range a.WorstFrames {
+			write("worst_"+strconv.Itoa(i+1)+"_frame", float64(f.Index))
+			write("worst_"+strconv.Itoa(i+1)+"_score", f.Score)
+		}
+	}
+	if r.SequenceScore != nil {
+		write("sequence_score", *r.SequenceScore)
+	}
+	cw.Flush()
+	return cw.Error()
+}
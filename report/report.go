@@ -0,0 +1,286 @@
+// Package report records govship scores in a stable format, so that every
+// tool scoring video with govship produces files the same dashboards can
+// ingest.
+//
+// A Report holds the metric, the handler parameters, the formats of both
+// inputs, the display model, the library versions, the device and the
+// scores. It is written as JSON carrying SchemaVersion, or as CSV. Field
+// names are part of the schema: they change only with SchemaVersion, and
+// only by adding fields within a version.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// SchemaVersion is the version of the JSON and CSV layout written by this
+// package.
+const SchemaVersion = 1
+
+// modulePath identifies govship in the build information.
+const modulePath = "github.com/GreatValueCreamSoda/govship"
+
+// Report is the record of one scoring run.
+type Report struct {
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Metric is "ssimu2", "butteraugli" or "cvvdp".
+	Metric     string     `json:"metric"`
+	Parameters Parameters `json:"parameters"`
+	Reference  Colorspace `json:"reference"`
+	Distorted  Colorspace `json:"distorted"`
+	// Display is the CVVDP display model, if a custom one was used.
+	Display  *DisplayModel `json:"display_model,omitempty"`
+	Versions Versions      `json:"versions"`
+	// Device is the GPU the scores were computed on, if it could be queried.
+	Device *Device `json:"device,omitempty"`
+	Frames []Frame `json:"frames"`
+	// Aggregate summarizes the per-frame scores of SSIMU2 and Butteraugli.
+	Aggregate *Aggregate `json:"aggregate,omitempty"`
+	// SequenceScore is the score of the whole sequence, the final JOD of
+	// CVVDP.
+	SequenceScore *float64 `json:"sequence_score,omitempty"`
+}
+
+// Parameters are the handler settings that affect the scores.
+type Parameters struct {
+	Qnorm                 int     `json:"qnorm,omitempty"`
+	DisplayBrightnessNits float32 `json:"display_brightness_nits,omitempty"`
+	FPS                   float32 `json:"fps,omitempty"`
+	ResizeToDisplay       bool    `json:"resize_to_display,omitempty"`
+	DisplayModelKey       string  `json:"display_model_key,omitempty"`
+}
+
+// Colorspace describes the format of an input, with enumerations written by
+// name.
+type Colorspace struct {
+	Width          int64  `json:"width"`
+	Height         int64  `json:"height"`
+	TargetWidth    int64  `json:"target_width"`
+	TargetHeight   int64  `json:"target_height"`
+	SamplingFormat string `json:"sampling_format"`
+	ColorRange     string `json:"color_range"`
+	ColorFamily    string `json:"color_family"`
+	// ChromaSubsampling holds the log2 horizontal and vertical factors.
+	ChromaSubsampling [2]int `json:"chroma_subsampling"`
+	ChromaLocation    string `json:"chroma_location"`
+	Matrix            string `json:"matrix"`
+	Transfer          string `json:"transfer"`
+	Primaries         string `json:"primaries"`
+	// Crop holds the top, bottom, left and right crop in pixels.
+	Crop [4]int `json:"crop"`
+}
+
+// DisplayModel is a vship.DisplayModel.
+type DisplayModel struct {
+	Key                   string  `json:"key,omitempty"`
+	Name                  string  `json:"name,omitempty"`
+	ColorSpace            string  `json:"colorspace"`
+	Width                 int     `json:"width"`
+	Height                int     `json:"height"`
+	MaxLuminance          float32 `json:"max_luminance"`
+	DiagonalSizeInches    float32 `json:"diagonal_size_inches"`
+	ViewingDistanceMeters float32 `json:"viewing_distance_meters"`
+	ContrastRatio         int     `json:"contrast_ratio"`
+	AmbientLux            int     `json:"ambient_lux"`
+	Reflectance           float32 `json:"reflectance"`
+	Exposure              float32 `json:"exposure"`
+}
+
+// Versions identifies the software that produced the scores.
+type Versions struct {
+	// Govship is the module version, "(devel)" for builds outside of a
+	// module release.
+	Govship string `json:"govship"`
+	Vship   string `json:"vship"`
+	Backend string `json:"backend"`
+}
+
+// Device describes a GPU as vship.DeviceInfo does.
+type Device struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	VRAMBytes       uint64 `json:"vram_bytes"`
+	Integrated      bool   `json:"integrated"`
+	Multiprocessors int    `json:"multiprocessors"`
+	WarpSize        int    `json:"warp_size"`
+}
+
+// Frame is the score of one frame. For CVVDP it is the JOD accumulated up to
+// the frame.
+type Frame struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+	// Butteraugli holds all three norms of Butteraugli frames; Score is
+	// their NormQ.
+	Butteraugli *ButteraugliNorms `json:"butteraugli,omitempty"`
+}
+
+// ButteraugliNorms is a vship.ButteraugliScore.
+type ButteraugliNorms struct {
+	NormQ   float64 `json:"norm_q"`
+	Norm3   float64 `json:"norm_3"`
+	NormInf float64 `json:"norm_inf"`
+}
+
+// Aggregate is a vship.AggregateSummary. The statistics that can be
+// undefined are null when they are: the harmonic mean if a score is not
+// positive, such as a Butteraugli score of 0 for identical frames, and the
+// minimum and maximum of an empty sequence.
+type Aggregate struct {
+	Count                  int      `json:"count"`
+	Mean                   float64  `json:"mean"`
+	HarmonicMean           *float64 `json:"harmonic_mean"`
+	Median                 float64  `json:"median"`
+	StdDev                 float64  `json:"stddev"`
+	Min                    *float64 `json:"min"`
+	Max                    *float64 `json:"max"`
+	P1                     float64  `json:"p1"`
+	P5                     float64  `json:"p5"`
+	P95                    float64  `json:"p95"`
+	WorstFrames            []Frame  `json:"worst_frames"`
+	HigherIsBetter         bool     `json:"higher_is_better"`
+	ApproximatePercentiles bool     `json:"approximate_percentiles"`
+}
+
+// finite returns a pointer to v, or nil if v is NaN or infinite, which JSON
+// cannot represent.
+func finite(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// New starts a report for handlers created from spec. The device of spec is
+// queried for its description; Device stays nil if that fails.
+func New(spec vship.HandlerSpec) *Report {
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Metric:        strings.ToLower(spec.Metric.String()),
+		Reference:     NewColorspace(spec.Source),
+		Distorted:     NewColorspace(spec.Distorted),
+		Versions:      currentVersions(),
+		Frames:        []Frame{},
+	}
+	switch spec.Metric {
+	case vship.MetricButteraugli:
+		r.Parameters.Qnorm = spec.Qnorm
+		r.Parameters.DisplayBrightnessNits = spec.DisplayBrightness
+		if spec.DisplayBrightness <= 0 {
+			r.Parameters.DisplayBrightnessNits =
+				vship.ButteraugliIntensityTarget(&spec.Source, nil)
+		}
+	case vship.MetricCVVDP:
+		r.Parameters.FPS = spec.FPS
+		r.Parameters.ResizeToDisplay = spec.ResizeToDisplay
+		r.Parameters.DisplayModelKey = spec.ModelKey
+	}
+
+	if info, code := vship.GetDeviceInfo(spec.Device); code.IsNone() {
+		r.Device = &Device{ID: spec.Device, Name: info.Name,
+			VRAMBytes: info.VRAMSize, Integrated: info.Integrated,
+			Multiprocessors: info.MultiProcessorCount,
+			WarpSize:        info.WarpSize}
+	}
+	return r
+}
+
+// currentVersions returns the versions of govship and of the Vship library
+// it is linked against.
+func currentVersions() Versions {
+	v := vship.GetVersion()
+	versions := Versions{Govship: "(devel)",
+		Vship:   fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.MinorMinor),
+		Backend: v.Backend.String()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == modulePath {
+			versions.Govship = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				versions.Govship = dep.Version
+			}
+		}
+	}
+	return versions
+}
+
+// SetDisplayModel records the CVVDP display model the scores were computed
+// with.
+func (r *Report) SetDisplayModel(m vship.DisplayModel) {
+	r.Display = &DisplayModel{Key: m.Key, Name: m.Name,
+		ColorSpace: string(m.ColorSpace), Width: m.DisplayWidth,
+		Height: m.DisplayHeight, MaxLuminance: m.DisplayMaxLuminance,
+		DiagonalSizeInches:    m.DisplayDiagonalSizeInches,
+		ViewingDistanceMeters: m.ViewingDistanceMeters,
+		ContrastRatio:         m.MonitorContrastRatio,
+		AmbientLux:            m.AmbientLightLevel,
+		Reflectance:           m.AmbientLightReflectionOnDisplay,
+		Exposure:              m.Exposure}
+	if m.Key != "" {
+		r.Parameters.DisplayModelKey = m.Key
+	}
+}
+
+// AddFrame records the score of a frame.
+func (r *Report) AddFrame(index int, score float64) {
+	r.Frames = append(r.Frames, Frame{Index: index, Score: score})
+}
+
+// AddButteraugliFrame records all norms of a Butteraugli frame.
+func (r *Report) AddButteraugliFrame(index int, s vship.ButteraugliScore) {
+	r.Frames = append(r.Frames, Frame{Index: index, Score: s.NormQ,
+		Butteraugli: &ButteraugliNorms{s.NormQ, s.Norm3, s.NormInf}})
+}
+
+// SetAggregate records the summary of the per-frame scores.
+func (r *Report) SetAggregate(s vship.AggregateSummary) {
+	a := &Aggregate{Count: s.Count, Mean: s.Mean,
+		HarmonicMean: finite(s.HarmonicMean), Median: s.Median,
+		StdDev: s.StdDev, Min: finite(s.Min), Max: finite(s.Max), P1: s.P1,
+		P5: s.P5, P95: s.P95,
+		WorstFrames:            []Frame{},
+		HigherIsBetter:         s.HigherIsBetter,
+		ApproximatePercentiles: s.ApproximatePercentile}
+	for _, f := range s.WorstFrames {
+		a.WorstFrames = append(a.WorstFrames, Frame{Index: f.Index,
+			Score: f.Score})
+	}
+	r.Aggregate = a
+}
+
+// SetSequenceScore records the score of the whole sequence.
+func (r *Report) SetSequenceScore(score float64) {
+	r.SequenceScore = &score
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// ReadJSON reads a report written by WriteJSON. Reports of a newer schema
+// version are rejected.
+func ReadJSON(rd io.Reader) (*Report, error) {
+	var r Report
+	if err := json.NewDecoder(rd).Decode(&r); err != nil {
+		return nil, fmt.Errorf("reading report: %w", err)
+	}
+	if r.SchemaVersion < 1 || r.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("unsupported report schema version %d",
+			r.SchemaVersion)
+	}
+	return &r, nil
+}
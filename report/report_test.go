@@ -0,0 +1,174 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+	"github.com/GreatValueCreamSoda/govship/report"
+)
+
+func butteraugliReport() *report.Report {
+	var cs vship.Colorspace
+	cs.SetDefaults(64, 32, vship.SamplingFormatUInt10)
+	cs.ColorTransfer = vship.ColorTransferTRCPQ
+	r := report.New(vship.HandlerSpec{Metric: vship.MetricButteraugli,
+		Source: cs, Distorted: cs, Qnorm: 2})
+
+	agg := vship.NewAggregator(vship.AggregatorOptions{WorstFrames: 1})
+	for i, s := range []vship.ButteraugliScore{{NormQ: 1.5, Norm3: 2,
+		NormInf: 4}, {NormQ: 0.5, Norm3: 1, NormInf: 3}} {
+		r.AddButteraugliFrame(i, s)
+		agg.AddFrame(i, s.NormQ)
+	}
+	r.SetAggregate(agg.Summary())
+	return r
+}
+
+func Test_New(t *testing.T) {
+	r := butteraugliReport()
+	if r.SchemaVersion != report.SchemaVersion || r.Metric != "butteraugli" {
+		t.Fatalf("unexpected header %d %q", r.SchemaVersion, r.Metric)
+	}
+	if p := r.Parameters; p.Qnorm != 2 || p.DisplayBrightnessNits != 10000 {
+		t.Fatalf("unexpected parameters %+v", p)
+	}
+	cs := r.Reference
+	if cs.Width != 64 || cs.SamplingFormat != "uint10" ||
+		cs.Transfer != "pq" || cs.ColorFamily != "yuv" {
+		t.Fatalf("unexpected colorspace %+v", cs)
+	}
+	if r.Versions.Vship == "" || r.Versions.Govship == "" {
+		t.Fatalf("missing versions %+v", r.Versions)
+	}
+}
+
+func Test_Report_JSON(t *testing.T) {
+	r := butteraugliReport()
+	r.SetDisplayModel(vship.DisplayModelPresetStandardHDRDarkRoom)
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"schema_version", "metric", "parameters",
+		"reference", "distorted", "display_model", "versions", "frames",
+		"aggregate"} {
+		if _, ok := fields[key]; !ok {
+			t.Fatalf("JSON lacks %q:\n%s", key, buf.Bytes())
+		}
+	}
+	// Zero values of the display model are written, not dropped.
+	display := fields["display_model"].(map[string]any)
+	if display["ambient_lux"] != 0.0 {
+		t.Fatalf("display model = %v", display)
+	}
+
+	back, err := report.ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Frames, r.Frames) ||
+		!reflect.DeepEqual(back.Aggregate, r.Aggregate) ||
+		!reflect.DeepEqual(back.Display, r.Display) {
+		t.Fatal("report changed in the round trip")
+	}
+
+	if _, err := report.ReadJSON(strings.NewReader(
+		`{"schema_version": 99}`)); err == nil {
+		t.Fatal("newer schema version accepted")
+	}
+}
+
+func Test_Report_UndefinedStatistics(t *testing.T) {
+	r := report.New(vship.HandlerSpec{Metric: vship.MetricButteraugli})
+	agg := vship.NewAggregator(vship.AggregatorOptions{})
+	// Identical frames have a Butteraugli score of 0, for which the
+	// harmonic mean is undefined.
+	r.AddButteraugliFrame(0, vship.ButteraugliScore{})
+	agg.AddFrame(0, 0)
+	r.SetAggregate(agg.Summary())
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var fields struct {
+		Aggregate map[string]any `json:"aggregate"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := fields.Aggregate["harmonic_mean"]; !ok || v != nil {
+		t.Fatalf("harmonic_mean = %v, %v, want null", v, ok)
+	}
+	if fields.Aggregate["min"] != 0.0 {
+		t.Fatalf("min = %v, want 0", fields.Aggregate["min"])
+	}
+
+	buf.Reset()
+	if err := r.WriteAggregateCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "harmonic_mean") {
+		t.Fatalf("aggregate CSV holds an undefined statistic:\n%s", &buf)
+	}
+
+	// An empty sequence has no minimum or maximum.
+	r.SetAggregate(vship.NewAggregator(vship.AggregatorOptions{}).Summary())
+	buf.Reset()
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if a := r.Aggregate; a.Min != nil || a.Max != nil {
+		t.Fatalf("empty aggregate min %v max %v", a.Min, a.Max)
+	}
+}
+
+func Test_Report_CSV(t *testing.T) {
+	r := butteraugliReport()
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"schema_version", "metric", "frame", "score", "norm_q", "norm_3",
+			"norm_inf"},
+		{"1", "butteraugli", "0", "1.5", "1.5", "2", "4"},
+		{"1", "butteraugli", "1", "0.5", "0.5", "1", "3"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("frames CSV = %v", rows)
+	}
+
+	buf.Reset()
+	r.SetSequenceScore(9.5)
+	if err := r.WriteAggregateCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err = csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := map[string]string{}
+	for _, row := range rows[1:] {
+		stats[row[2]] = row[3]
+	}
+	if stats["count"] != "2" || stats["mean"] != "1" ||
+		stats["worst_1_frame"] != "0" || stats["worst_1_score"] != "1.5" ||
+		stats["sequence_score"] != "9.5" {
+		t.Fatalf("aggregate CSV = %v", rows)
+	}
+}
@@ -0,0 +1,287 @@
+package govship
+
+import (
+	"image"
+	"math"
+)
+
+// WeightMask assigns a non-negative importance weight to every pixel of a
+// frame.
+//
+// Masks are used to emphasize regions such as faces, text or UI elements when
+// pooling a score, and to exclude regions such as burnt-in watermarks by
+// giving them a weight of 0. Values are stored row major with no padding. A
+// mask does not need to match the resolution of the scored frames; it is
+// scaled with nearest neighbour sampling to the size it is applied to.
+type WeightMask struct {
+	Width, Height int
+	Data          []float32
+}
+
+// WeightedRegion is a rectangle of a WeightMask sharing a single weight.
+// Rectangle coordinates are in mask pixels.
+type WeightedRegion struct {
+	Rect   image.Rectangle
+	Weight float32
+}
+
+// WeightedScore holds a score pooled over the whole frame alongside the same
+// score pooled with a WeightMask.
+type WeightedScore struct {
+	// Global is the score of the whole frame, ignoring the mask.
+	Global float64
+	// ROI is the score with every pixel or tile weighted by the mask.
+	ROI float64
+}
+
+// NewWeightMask allocates a WeightMask of the given size with every pixel set
+// to weight.
+func NewWeightMask(width, height int, weight float32) *WeightMask {
+	m := &WeightMask{width, height, make([]float32, width*height)}
+	for i := range m.Data {
+		m.Data[i] = weight
+	}
+	return m
+}
+
+// WeightMaskFromRegions builds a WeightMask of the given size where every
+// pixel has the background weight unless it is covered by one of regions.
+// Regions are painted in order, so later regions override earlier ones where
+// they overlap. Parts of a region outside the mask are ignored.
+func WeightMaskFromRegions(width, height int, background float32,
+	regions []WeightedRegion) *WeightMask {
+	m := NewWeightMask(width, height, background)
+	bounds := image.Rect(0, 0, width, height)
+	for _, region := range regions {
+		r := region.Rect.Intersect(bounds)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.Data[y*width+x] = region.Weight
+			}
+		}
+	}
+	return m
+}
+
+// at returns the weight for pixel (x, y) of an image of the given size.
+func (m *WeightMask) at(x, y, width, height int) float32 {
+	mx := x * m.Width / width
+	my := y * m.Height / height
+	return m.Data[my*m.Width+mx]
+}
+
+// regionMean returns the mean weight of the part of the mask covering the
+// fractional rectangle [fx0, fx1) x [fy0, fy1) of the frame.
+func (m *WeightMask) regionMean(fx0, fy0, fx1, fy1 float64) float64 {
+	x0 := int(math.Floor(fx0 * float64(m.Width)))
+	y0 := int(math.Floor(fy0 * float64(m.Height)))
+	x1 := max(int(math.Ceil(fx1*float64(m.Width))), x0+1)
+	y1 := max(int(math.Ceil(fy1*float64(m.Height))), y0+1)
+	x1, y1 = min(x1, m.Width), min(y1, m.Height)
+
+	var sum float64
+	var count int
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			sum += float64(m.Data[y*m.Width+x])
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return sum / float64(count)
+}
+
+// WeightedPNorm returns the p-norm of the map with every pixel weighted by
+// mask, (sum(w*|v|^p) / sum(w))^(1/p). A p of +Inf returns the largest
+// absolute value among pixels with a non-zero weight. If every weight is zero
+// the result is 0.
+func (m *DistortionMap) WeightedPNorm(mask *WeightMask, p float64) float64 {
+	var sum, weights, peak float64
+	for y := range m.Height {
+		for x := range m.Width {
+			w := float64(mask.at(x, y, m.Width, m.Height))
+			if w <= 0 {
+				continue
+			}
+			v := math.Abs(float64(m.At(x, y)))
+			peak = max(peak, v)
+			sum += w * math.Pow(v, p)
+			weights += w
+		}
+	}
+	if weights == 0 {
+		return 0
+	}
+	if math.IsInf(p, 1) {
+		return peak
+	}
+	return math.Pow(sum/weights, 1/p)
+}
+
+// WeightedMean returns the mean of the map with every pixel weighted by mask.
+func (m *DistortionMap) WeightedMean(mask *WeightMask) float64 {
+	return m.WeightedPNorm(mask, 1)
+}
+
+// ComputeWeightedScore scores a frame pair like ComputeScoreWithMap and pools
+// the distortion map with mask.
+//
+// Global is the NormQ of the frame and ROI is the same Q-norm computed with
+// every pixel weighted by the mask, so both values are directly comparable.
+func (handler *ButteraugliHandler) ComputeWeightedScore(mask *WeightMask,
+	src1, src2 [3][]byte, srcLineSize1, srcLineSize2 [3]int64,
+) (WeightedScore, ExceptionCode) {
+	score, dmap, code := handler.ComputeScoreWithMap(src1, src2, srcLineSize1,
+		srcLineSize2)
+	if !code.IsNone() {
+		return WeightedScore{}, code
+	}
+	return WeightedScore{score.NormQ,
+		dmap.WeightedPNorm(mask, float64(handler.qnorm))}, code
+}
+
+// ComputeWeightedScore submits a frame pair like ComputeScoreWithMap and pools
+// the distortion map of the frame with mask.
+//
+// The first return value is the accumulated JOD score of the sequence, as
+// returned by ComputeScore. The WeightedScore describes the submitted frame
+// only: Global is the mean of its distortion map and ROI the mean weighted by
+// the mask. Higher values mean more visible distortion.
+func (h *CVVDPHandler) ComputeWeightedScore(mask *WeightMask, src,
+	distorted [3][]byte, srcLineSize, dstLineSize [3]int64) (float64,
+	WeightedScore, ExceptionCode) {
+	jod, dmap, code := h.ComputeScoreWithMap(src, distorted, srcLineSize,
+		dstLineSize)
+	if !code.IsNone() {
+		return 0, WeightedScore{}, code
+	}
+	return jod, WeightedScore{dmap.Mean(), dmap.WeightedMean(mask)}, code
+}
+
+// ssimu2TileKey identifies a tile of a cols x rows grid.
+type ssimu2TileKey struct{ cols, rows, index int }
+
+// ComputeWeightedScore scores a frame pair with SSIMU2 and additionally
+// scores it tile by tile to weight the result by mask.
+//
+// The frame is split into a cols x rows grid. Every tile with a non-zero mean
+// weight is scored on its own and ROI is the average of the tile scores
+// weighted by their mean mask weight. Global is the score of the whole frame
+// as returned by ComputeScore. Tiles with a zero weight are not scored at all,
+// so regions such as watermarks can be excluded completely.
+//
+// Tiles are scored by handlers that crop the input, which are created on
+// first use and kept until the handler is closed. Tile edges are aligned to
+// the chroma subsampling of the source. SSIMU2 works on a multi-scale
+// pyramid, so tiles should be at least 64 pixels in each direction.
+func (handler *SSIMU2Handler) ComputeWeightedScore(mask *WeightMask, cols,
+	rows int, sourceData, distortedData [3][]byte, sourceLineSize,
+	distortedLineSize [3]int64) (WeightedScore, ExceptionCode) {
+	global, code := handler.ComputeScore(sourceData, distortedData,
+		sourceLineSize, distortedLineSize)
+	if !code.IsNone() {
+		return WeightedScore{}, code
+	}
+
+	srcTiles := tileGrid(&handler.source, cols, rows)
+	dstTiles := tileGrid(&handler.distortion, cols, rows)
+
+	var sum, weights float64
+	for i := range srcTiles {
+		fx0, fy0, fx1, fy1 := srcTiles[i].fraction(&handler.source)
+		w := mask.regionMean(fx0, fy0, fx1, fy1)
+		if w <= 0 {
+			continue
+		}
+
+		key := ssimu2TileKey{cols, rows, i}
+		tile, ok := handler.tiles[key]
+		if !ok {
+			src, dst := handler.source, handler.distortion
+			srcTiles[i].apply(&src)
+			dstTiles[i].apply(&dst)
+			tile, code = NewSSIMU2Handler(&src, &dst)
+			if !code.IsNone() {
+				return WeightedScore{}, code
+			}
+			if handler.tiles == nil {
+				handler.tiles = make(map[ssimu2TileKey]*SSIMU2Handler)
+			}
+			handler.tiles[key] = tile
+		}
+
+		score, code := tile.ComputeScore(sourceData, distortedData,
+			sourceLineSize, distortedLineSize)
+		if !code.IsNone() {
+			return WeightedScore{}, code
+		}
+		sum += w * score
+		weights += w
+	}
+
+	if weights == 0 {
+		return WeightedScore{global, 0}, code
+	}
+	return WeightedScore{global, sum / weights}, code
+}
+
+// tileRect is a tile in pixel coordinates of the uncropped image.
+type tileRect struct{ x0, y0, x1, y1 int }
+
+// tileGrid splits the cropped area of a Colorspace into a cols x rows grid of
+// tiles aligned to the chroma subsampling.
+func tileGrid(cs *Colorspace, cols, rows int) []tileRect {
+	alignW, alignH := 1, 1
+	if cs.ColorFamily == ColorFamilyYUV {
+		alignW = 1 << cs.ChromaSubsamplingWidth
+		alignH = 1 << cs.ChromaSubsamplingHeight
+	}
+
+	cropW := int(cs.Width) - cs.CropLeft - cs.CropRight
+	cropH := int(cs.Height) - cs.CropTop - cs.CropBottom
+	edge := func(i, n, size, align int) int {
+		if i == n {
+			return size
+		}
+		return i * size / n / align * align
+	}
+
+	tiles := make([]tileRect, 0, cols*rows)
+	for ty := range rows {
+		for tx := range cols {
+			tiles = append(tiles, tileRect{
+				cs.CropLeft + edge(tx, cols, cropW, alignW),
+				cs.CropTop + edge(ty, rows, cropH, alignH),
+				cs.CropLeft + edge(tx+1, cols, cropW, alignW),
+				cs.CropTop + edge(ty+1, rows, cropH, alignH),
+			})
+		}
+	}
+	return tiles
+}
+
+// fraction returns the tile as a fraction of the cropped area of cs.
+func (t tileRect) fraction(cs *Colorspace) (fx0, fy0, fx1, fy1 float64) {
+	cropW := float64(int(cs.Width) - cs.CropLeft - cs.CropRight)
+	cropH := float64(int(cs.Height) - cs.CropTop - cs.CropBottom)
+	return float64(t.x0-cs.CropLeft) / cropW, float64(t.y0-cs.CropTop) / cropH,
+		float64(t.x1-cs.CropLeft) / cropW, float64(t.y1-cs.CropTop) / cropH
+}
+
+// apply restricts cs to the tile by adjusting its crop rectangle. A resize
+// target is scaled down to the share of the image covered by the tile.
+func (t tileRect) apply(cs *Colorspace) {
+	fx0, fy0, fx1, fy1 := t.fraction(cs)
+	if cs.TargetWidth > 0 {
+		cs.TargetWidth = int64(math.Round((fx1 - fx0) *
+			float64(cs.TargetWidth)))
+	}
+	if cs.TargetHeight > 0 {
+		cs.TargetHeight = int64(math.Round((fy1 - fy0) *
+			float64(cs.TargetHeight)))
+	}
+	cs.CropLeft, cs.CropTop = t.x0, t.y0
+	cs.CropRight, cs.CropBottom = int(cs.Width)-t.x1, int(cs.Height)-t.y1
+}
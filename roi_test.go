@@ -0,0 +1,56 @@
+package govship_test
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_WeightMaskFromRegions(t *testing.T) {
+	mask := vship.WeightMaskFromRegions(4, 4, 1, []vship.WeightedRegion{
+		{Rect: image.Rect(0, 0, 2, 2), Weight: 4},
+		{Rect: image.Rect(1, 1, 10, 10), Weight: 0},
+	})
+
+	want := []float32{
+		4, 4, 1, 1,
+		4, 0, 0, 0,
+		1, 0, 0, 0,
+		1, 0, 0, 0,
+	}
+	for i := range want {
+		if mask.Data[i] != want[i] {
+			t.Fatalf("mask = %v, want %v", mask.Data, want)
+		}
+	}
+}
+
+func Test_DistortionMap_WeightedPNorm(t *testing.T) {
+	dmap := vship.NewDistortionMap(2, 2)
+	copy(dmap.Data, []float32{1, 2, 3, 100})
+
+	// The mask is half the map resolution in x, so each mask pixel covers a
+	// column pair: only the top row is weighted and the 100 is ignored.
+	mask := vship.WeightMaskFromRegions(1, 2, 0, []vship.WeightedRegion{
+		{Rect: image.Rect(0, 0, 1, 1), Weight: 1},
+	})
+
+	if mean := dmap.WeightedMean(mask); mean != 1.5 {
+		t.Fatalf("WeightedMean = %f, want 1.5", mean)
+	}
+	if peak := dmap.WeightedPNorm(mask, math.Inf(1)); peak != 2 {
+		t.Fatalf("WeightedPNorm(Inf) = %f, want 2", peak)
+	}
+
+	uniform := vship.NewWeightMask(2, 2, 3)
+	if got, want := dmap.WeightedPNorm(uniform, 3), dmap.PNorm(3); math.Abs(
+		got-want) > 1e-9 {
+		t.Fatalf("uniform mask changed the norm: %f != %f", got, want)
+	}
+
+	if got := dmap.WeightedMean(vship.NewWeightMask(1, 1, 0)); got != 0 {
+		t.Fatalf("all-zero mask should pool to 0, got %f", got)
+	}
+}
@@ -0,0 +1,245 @@
+package govship
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+)
+
+// SamplingMethod selects which frames SampleScores scores.
+type SamplingMethod int
+
+const (
+	// SamplingEveryNth scores frames 0, N, 2N and so on.
+	SamplingEveryNth SamplingMethod = iota
+	// SamplingRandom scores each frame independently with probability 1/N.
+	SamplingRandom
+	// SamplingSceneStratified splits every scene into blocks of N frames and
+	// scores one random frame of each block. Every scene is represented,
+	// however short, and scenes contribute in proportion to their length.
+	SamplingSceneStratified
+)
+
+// SamplerOptions configures SampleScores.
+type SamplerOptions struct {
+	Method SamplingMethod
+	// Interval is N, the average number of frames per scored frame.
+	// Defaults to 10.
+	Interval int
+	// Seed seeds the random choices of the random and stratified methods and
+	// of the bootstrap, so that results are reproducible.
+	Seed uint64
+	// Detector configures scene detection for SamplingSceneStratified.
+	Detector SceneDetectorOptions
+	// Pool provides the frame buffers. If nil, they are allocated for the
+	// call.
+	Pool *FramePool
+	// Aggregator configures the summary of the sampled scores.
+	Aggregator AggregatorOptions
+	// Resamples is the number of bootstrap resamples. Defaults to 1000.
+	Resamples int
+	// Confidence is the coverage of the confidence intervals, between 0 and
+	// 1. Defaults to 0.95.
+	Confidence float64
+}
+
+// ConfidenceInterval is an interval [Low, High] expected to contain the value
+// of a statistic over all frames with the requested confidence.
+type ConfidenceInterval struct {
+	Low, High float64
+}
+
+// SampledSummary is the outcome of SampleScores.
+type SampledSummary struct {
+	// Summary aggregates the scored frames. The indices of its WorstFrames
+	// are frame indices in the full sequence.
+	Summary AggregateSummary
+	// Frames lists the scored frames in order.
+	Frames []FrameScore
+	// TotalFrames is the number of frames in the sequence.
+	TotalFrames int
+	// Confidence is the coverage of the intervals below.
+	Confidence float64
+	// Bootstrap confidence intervals of the mean, median and 5th and 95th
+	// percentiles of the scores of all frames.
+	Mean, Median, P5, P95 ConfidenceInterval
+}
+
+// SampleScores estimates the aggregate score of a sequence by scoring only a
+// subset of its frames.
+//
+// Every frame of ref and dist is still read, so the savings come from the
+// scorer alone, which usually dominates. The confidence intervals come from a
+// percentile bootstrap over the scored frames; for scene-stratified sampling
+// the frames are resampled within each scene. Consecutive frames are often
+// correlated, so for the systematic SamplingEveryNth the intervals should be
+// read as approximate.
+func SampleScores(scorer FrameScorer, ref, dist FrameSource,
+	opts SamplerOptions) (*SampledSummary, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 10
+	}
+	if opts.Resamples <= 0 {
+		opts.Resamples = 1000
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		opts.Confidence = 0.95
+	}
+	rng := rand.New(rand.NewPCG(opts.Seed, 0))
+
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	refFrame := opts.Pool.Acquire(&refCS)
+	distFrame := opts.Pool.Acquire(&distCS)
+	defer opts.Pool.Release(refFrame)
+	defer opts.Pool.Release(distFrame)
+
+	agg := NewAggregator(opts.Aggregator)
+	result := &SampledSummary{Confidence: opts.Confidence}
+	// strata holds the scores of each scene, or a single stratum for the
+	// methods that ignore scenes.
+	strata := [][]float64{nil}
+	score := func(index int, r, d *Frame) error {
+		s, code := scorer.ScoreFrame(r, d)
+		if !code.IsNone() {
+			return code.Err()
+		}
+		agg.AddFrame(index, s)
+		result.Frames = append(result.Frames, FrameScore{Index: index,
+			Score: s})
+		strata[len(strata)-1] = append(strata[len(strata)-1], s)
+		return nil
+	}
+
+	// The stratified method keeps a copy of the frame chosen so far in the
+	// current block, replacing it with probability 1/k at the k-th frame.
+	var detector *SceneDetector
+	var candRef, candDist *Frame
+	candIndex, blockPos := -1, 0
+	flush := func() error {
+		blockPos = 0
+		if candIndex < 0 {
+			return nil
+		}
+		index := candIndex
+		candIndex = -1
+		return score(index, candRef, candDist)
+	}
+	if opts.Method == SamplingSceneStratified {
+		detector = NewSceneDetector(opts.Detector)
+		candRef, candDist = opts.Pool.Acquire(&refCS),
+			opts.Pool.Acquire(&distCS)
+		defer opts.Pool.Release(candRef)
+		defer opts.Pool.Release(candDist)
+	}
+
+	index := 0
+	for ; ; index++ {
+		ok, err := readPair(ref, dist, refFrame, distFrame, index)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		switch opts.Method {
+		case SamplingEveryNth:
+			if index%opts.Interval == 0 {
+				err = score(index, refFrame, distFrame)
+			}
+		case SamplingRandom:
+			if rng.IntN(opts.Interval) == 0 {
+				err = score(index, refFrame, distFrame)
+			}
+		case SamplingSceneStratified:
+			var cut bool
+			if cut, err = detector.Next(&refCS, refFrame); err != nil {
+				return nil, err
+			}
+			if cut {
+				if err = flush(); err != nil {
+					return nil, err
+				}
+				strata = append(strata, nil)
+			}
+			blockPos++
+			if rng.IntN(blockPos) == 0 {
+				copyFrame(candRef, refFrame)
+				copyFrame(candDist, distFrame)
+				candIndex = index
+			}
+			if blockPos == opts.Interval {
+				err = flush()
+			}
+		default:
+			return nil, errors.New("unknown sampling method")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if detector != nil {
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	if agg.Count() == 0 {
+		return nil, errors.New("no frames were sampled")
+	}
+	result.TotalFrames = index
+	result.Summary = agg.Summary()
+	result.bootstrap(strata, opts, rng)
+	return result, nil
+}
+
+// bootstrap fills the confidence intervals of s by resampling the scores of
+// each stratum with replacement.
+func (s *SampledSummary) bootstrap(strata [][]float64, opts SamplerOptions,
+	rng *rand.Rand) {
+	var n int
+	for _, stratum := range strata {
+		n += len(stratum)
+	}
+
+	means := make([]float64, opts.Resamples)
+	medians := make([]float64, opts.Resamples)
+	p5s := make([]float64, opts.Resamples)
+	p95s := make([]float64, opts.Resamples)
+	resample := make([]float64, 0, n)
+	for r := range opts.Resamples {
+		resample = resample[:0]
+		var sum float64
+		for _, stratum := range strata {
+			for range stratum {
+				v := stratum[rng.IntN(len(stratum))]
+				resample = append(resample, v)
+				sum += v
+			}
+		}
+		slices.Sort(resample)
+		means[r] = sum / float64(n)
+		medians[r] = sortedPercentile(resample, 50)
+		p5s[r] = sortedPercentile(resample, 5)
+		p95s[r] = sortedPercentile(resample, 95)
+	}
+
+	tail := 100 * (1 - opts.Confidence) / 2
+	interval := func(values []float64) ConfidenceInterval {
+		slices.Sort(values)
+		return ConfidenceInterval{sortedPercentile(values, tail),
+			sortedPercentile(values, 100-tail)}
+	}
+	s.Mean = interval(means)
+	s.Median = interval(medians)
+	s.P5 = interval(p5s)
+	s.P95 = interval(p95s)
+}
+
+// Contains reports whether v lies in the interval.
+func (c ConfidenceInterval) Contains(v float64) bool {
+	return c.Low <= v && v <= c.High
+}
+
+// Width returns the length of the interval.
+func (c ConfidenceInterval) Width() float64 { return c.High - c.Low }
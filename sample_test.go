@@ -0,0 +1,119 @@
+package govship_test
+
+import (
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// lumaScorer scores a frame pair with the first luma sample of the distorted
+// frame, which lets the sampling be tested without a GPU.
+type lumaScorer struct{ calls int }
+
+func (s *lumaScorer) ScoreFrame(ref, dist *vship.Frame) (float64,
+	vship.ExceptionCode) {
+	s.calls++
+	return float64(dist.Planes[0][0]), vship.ExceptionCodeNoError
+}
+
+func Test_SampleScores_EveryNth(t *testing.T) {
+	var levels []byte
+	var sum float64
+	for i := range 200 {
+		levels = append(levels, byte(50+i%37))
+		sum += float64(50 + i%37)
+	}
+
+	scorer := &lumaScorer{}
+	result, err := vship.SampleScores(scorer, grayFrames(16, 16, levels...),
+		grayFrames(16, 16, levels...), vship.SamplerOptions{Interval: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scorer.calls != 20 || len(result.Frames) != 20 {
+		t.Fatalf("scored %d frames, want 20", scorer.calls)
+	}
+	for i, f := range result.Frames {
+		if f.Index != i*10 {
+			t.Fatalf("frame %d has index %d, want %d", i, f.Index, i*10)
+		}
+	}
+	if result.TotalFrames != 200 {
+		t.Fatalf("TotalFrames = %d, want 200", result.TotalFrames)
+	}
+
+	mean := result.Summary.Mean
+	if !result.Mean.Contains(mean) || result.Mean.Width() <= 0 {
+		t.Fatalf("mean CI %v does not contain sample mean %f", result.Mean,
+			mean)
+	}
+	if !result.Mean.Contains(sum / 200) {
+		t.Fatalf("mean CI %v does not contain full mean %f", result.Mean,
+			sum/200)
+	}
+}
+
+func Test_SampleScores_Random(t *testing.T) {
+	levels := make([]byte, 500)
+	for i := range levels {
+		levels[i] = byte(i)
+	}
+	opts := vship.SamplerOptions{Method: vship.SamplingRandom, Interval: 5,
+		Seed: 7}
+
+	run := func() *vship.SampledSummary {
+		result, err := vship.SampleScores(&lumaScorer{},
+			grayFrames(16, 16, levels...), grayFrames(16, 16, levels...),
+			opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	a, b := run(), run()
+
+	if n := len(a.Frames); n < 70 || n > 130 {
+		t.Fatalf("sampled %d of 500 frames, want about 100", n)
+	}
+	if len(a.Frames) != len(b.Frames) || a.Mean != b.Mean {
+		t.Fatal("same seed should give the same sample")
+	}
+}
+
+func Test_SampleScores_SceneStratified(t *testing.T) {
+	var levels []byte
+	for range 40 {
+		levels = append(levels, 40)
+	}
+	for range 4 {
+		levels = append(levels, 220) // short scene
+	}
+	for range 40 {
+		levels = append(levels, 120)
+	}
+
+	result, err := vship.SampleScores(&lumaScorer{},
+		grayFrames(16, 16, levels...), grayFrames(16, 16, levels...),
+		vship.SamplerOptions{Method: vship.SamplingSceneStratified,
+			Interval: 10, Detector: vship.SceneDetectorOptions{
+				MinSceneLength: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 blocks in each long scene and one in the short one.
+	if len(result.Frames) != 9 {
+		t.Fatalf("sampled %d frames, want 9: %v", len(result.Frames),
+			result.Frames)
+	}
+	short := 0
+	for _, f := range result.Frames {
+		if f.Index >= 40 && f.Index < 44 {
+			short++
+		}
+	}
+	if short != 1 {
+		t.Fatalf("short scene sampled %d times, want 1", short)
+	}
+}
@@ -0,0 +1,233 @@
+package govship
+
+import "math"
+
+// SceneDetectorOptions configures a SceneDetector.
+type SceneDetectorOptions struct {
+	// Threshold is the frame difference at or above which a scene cut is
+	// reported. The difference is the average of the luma histogram
+	// distance and the mean absolute luma difference of two consecutive
+	// frames, both between 0 and 1. Defaults to 0.25.
+	Threshold float64
+	// MinSceneLength is the minimum number of frames in a scene. Cuts closer
+	// than this to the previous cut are ignored, which suppresses flashes and
+	// strobing. Defaults to 12.
+	MinSceneLength int
+	// AnalysisWidth is the approximate width in pixels frames are decimated
+	// to before they are compared. Defaults to 128.
+	AnalysisWidth int
+}
+
+// Scene is a range of frames [Start, End) between two scene cuts.
+type Scene struct {
+	Start, End int
+}
+
+// sceneHistogramBins is the number of luma histogram bins compared between
+// frames.
+const sceneHistogramBins = 32
+
+// SceneDetector finds scene cuts in a sequence from the luma of consecutive
+// frames. It is implemented in pure Go and does not use the GPU.
+type SceneDetector struct {
+	opts SceneDetectorOptions
+
+	index     int
+	lastCut   int
+	prevLuma  []float32
+	prevHist  [sceneHistogramBins]float64
+	hasPrev   bool
+	lastDelta float64
+}
+
+// NewSceneDetector creates a SceneDetector. Zero fields of opts are replaced
+// by their defaults.
+func NewSceneDetector(opts SceneDetectorOptions) *SceneDetector {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 0.25
+	}
+	if opts.MinSceneLength <= 0 {
+		opts.MinSceneLength = 12
+	}
+	if opts.AnalysisWidth <= 0 {
+		opts.AnalysisWidth = 128
+	}
+	return &SceneDetector{opts: opts}
+}
+
+// Next analyzes the next frame of the sequence and reports whether a new
+// scene starts at it. The first frame never starts a new scene.
+func (d *SceneDetector) Next(cs *Colorspace, frame *Frame) (bool, error) {
+	step := max(int(cs.Width)/d.opts.AnalysisWidth, 1)
+	_, _, luma, err := readLuma(cs, frame.Planes, frame.LineSize, step)
+	if err != nil {
+		return false, err
+	}
+
+	var hist [sceneHistogramBins]float64
+	for _, v := range luma {
+		bin := int(min(max(v, 0), 1) * (sceneHistogramBins - 1))
+		hist[bin] += 1 / float64(len(luma))
+	}
+
+	index := d.index
+	d.index++
+	cut := false
+	if d.hasPrev && len(d.prevLuma) == len(luma) {
+		var histDist, sad float64
+		for i := range hist {
+			histDist += math.Abs(hist[i] - d.prevHist[i])
+		}
+		for i := range luma {
+			sad += math.Abs(float64(luma[i] - d.prevLuma[i]))
+		}
+		d.lastDelta = (histDist/2 + sad/float64(len(luma))) / 2
+
+		if d.lastDelta >= d.opts.Threshold &&
+			index-d.lastCut >= d.opts.MinSceneLength {
+			cut = true
+			d.lastCut = index
+		}
+	}
+
+	d.prevLuma, d.prevHist, d.hasPrev = luma, hist, true
+	return cut, nil
+}
+
+// LastDifference returns the frame difference computed by the last call to
+// Next, which is useful to tune Threshold.
+func (d *SceneDetector) LastDifference() float64 { return d.lastDelta }
+
+// DetectScenes reads every frame of src and splits the sequence into scenes.
+func DetectScenes(src FrameSource, opts SceneDetectorOptions) ([]Scene,
+	error) {
+	cs := src.Colorspace()
+	detector := NewSceneDetector(opts)
+	frame := NewFrame(&cs)
+
+	var scenes []Scene
+	start, index := 0, 0
+	for ; ; index++ {
+		if err := src.ReadFrame(frame); err != nil {
+			if isEOF(err) {
+				break
+			}
+			return nil, err
+		}
+		cut, err := detector.Next(&cs, frame)
+		if err != nil {
+			return nil, err
+		}
+		if cut {
+			scenes = append(scenes, Scene{start, index})
+			start = index
+		}
+	}
+	if index > start {
+		scenes = append(scenes, Scene{start, index})
+	}
+	return scenes, nil
+}
+
+// SceneScore is the CVVDP score of a single scene.
+type SceneScore struct {
+	Scene
+	// JOD score of the frames of the scene.
+	Score float64
+}
+
+// SceneScoreResult holds the outcome of ScoreScenesCVVDP.
+type SceneScoreResult struct {
+	Scenes []SceneScore
+	// FullScore is the JOD score of the whole sequence. It is NaN when the
+	// full sequence score was skipped.
+	FullScore float64
+}
+
+// SceneScorerOptions configures ScoreScenesCVVDP.
+type SceneScorerOptions struct {
+	Detector SceneDetectorOptions
+	// SkipFullScore disables scoring the sequence as a whole, which halves
+	// the GPU work.
+	SkipFullScore bool
+}
+
+// ScoreScenesCVVDP scores every scene of a sequence independently with CVVDP.
+//
+// Scene cuts are detected on the reference frames. At each cut the score of
+// the finished scene is recorded and ResetScore is called, so the temporal
+// adaptation of the metric carries over the cut while each scene gets its
+// own JOD. Unless opts.SkipFullScore is set, a second handler with the same
+// configuration as h scores the sequence without resets to provide the full
+// sequence score.
+//
+// h must be configured for the formats of ref and dist. Its temporal state is
+// used as is, call Reset first to start from a clean state.
+func ScoreScenesCVVDP(h *CVVDPHandler, ref, dist FrameSource,
+	opts SceneScorerOptions) (SceneScoreResult, error) {
+	result := SceneScoreResult{FullScore: math.NaN()}
+
+	var full *CVVDPHandler
+	if !opts.SkipFullScore {
+		var code ExceptionCode
+		full, code = h.clone()
+		if !code.IsNone() {
+			return result, code.Err()
+		}
+		defer full.Close()
+	}
+
+	if code := h.ResetScore(); !code.IsNone() {
+		return result, code.Err()
+	}
+
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	refFrame, distFrame := NewFrame(&refCS), NewFrame(&distCS)
+	detector := NewSceneDetector(opts.Detector)
+
+	var score float64
+	start, index := 0, 0
+	for ; ; index++ {
+		ok, err := readPair(ref, dist, refFrame, distFrame, index)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			break
+		}
+
+		cut, err := detector.Next(&refCS, refFrame)
+		if err != nil {
+			return result, err
+		}
+		if cut {
+			result.Scenes = append(result.Scenes,
+				SceneScore{Scene{start, index}, score})
+			start = index
+			if code := h.ResetScore(); !code.IsNone() {
+				return result, code.Err()
+			}
+		}
+
+		var code ExceptionCode
+		score, code = h.ComputeScore(nil, 0, refFrame.Planes,
+			distFrame.Planes, refFrame.LineSize, distFrame.LineSize)
+		if !code.IsNone() {
+			return result, code.Err()
+		}
+		if full != nil {
+			result.FullScore, code = full.ComputeScore(nil, 0,
+				refFrame.Planes, distFrame.Planes, refFrame.LineSize,
+				distFrame.LineSize)
+			if !code.IsNone() {
+				return result, code.Err()
+			}
+		}
+	}
+
+	if index > start {
+		result.Scenes = append(result.Scenes,
+			SceneScore{Scene{start, index}, score})
+	}
+	return result, nil
+}
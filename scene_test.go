@@ -0,0 +1,34 @@
+package govship_test
+
+import (
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_DetectScenes(t *testing.T) {
+	var levels []byte
+	for i := range 30 {
+		levels = append(levels, 60+byte(i%3)) // slight flicker
+	}
+	for range 20 {
+		levels = append(levels, 200)
+	}
+	levels = append(levels, 60, 60) // too short to start a scene
+
+	scenes, err := vship.DetectScenes(grayFrames(64, 32, levels...),
+		vship.SceneDetectorOptions{MinSceneLength: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []vship.Scene{{Start: 0, End: 30}, {Start: 30, End: 52}}
+	if len(scenes) != len(want) {
+		t.Fatalf("scenes = %v, want %v", scenes, want)
+	}
+	for i := range want {
+		if scenes[i] != want[i] {
+			t.Fatalf("scenes = %v, want %v", scenes, want)
+		}
+	}
+}
@@ -20,6 +20,10 @@ import (
 type SSIMU2Handler struct {
 	ptr  *C.Vship_SSIMU2Handler
 	init bool
+	// Formats the handler was created for.
+	source, distortion Colorspace
+	// Handlers scoring single tiles, created by ComputeWeightedScore.
+	tiles map[ssimu2TileKey]*SSIMU2Handler
 }
 
 // NewSSIMU2Handler creates a new SSIMU2Handler for the given source and
@@ -44,6 +48,7 @@ func NewSSIMU2Handler(source, distortion *Colorspace) (*SSIMU2Handler,
 	}
 
 	handler.init = true
+	handler.source, handler.distortion = *source, *distortion
 
 	return &handler, code
 }
@@ -82,11 +87,23 @@ func (handler *SSIMU2Handler) ComputeScore(sourceData, distortedData [3][]byte,
 	return float64(score), ExceptionCode(code)
 }
 
+// ScoreFrame computes the SSIMU2 score of a pair of frames. It implements
+// FrameScorer.
+func (handler *SSIMU2Handler) ScoreFrame(ref, dist *Frame) (float64,
+	ExceptionCode) {
+	return handler.ComputeScore(ref.Planes, dist.Planes, ref.LineSize,
+		dist.LineSize)
+}
+
 // Close frees all resources associated with the SSIMU2Handler.
 //
 // After calling Close, the handler should no longer be used. Returns an
 // ExceptionCode indicating whether the operation succeeded.
 func (handler *SSIMU2Handler) Close() ExceptionCode {
+	for key, tile := range handler.tiles {
+		tile.Close()
+		delete(handler.tiles, key)
+	}
 	if handler.ptr != nil && handler.init {
 		handler.init = false
 		code := ExceptionCode(C.Vship_SSIMU2Free(*handler.ptr))
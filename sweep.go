@@ -0,0 +1,229 @@
+package govship
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// SweepOptions configures SweepCVVDP. Each axis lists the values to try; an
+// empty axis keeps the value of the base model. The variants are every
+// combination of the axes.
+type SweepOptions struct {
+	// ViewingDistances in meters.
+	ViewingDistances []float32
+	// DiagonalSizes in inches. The resolution of the base model is kept.
+	DiagonalSizes []float32
+	// PeakLuminances in cd/m².
+	PeakLuminances []float32
+	// AmbientLevels in lux.
+	AmbientLevels []int
+	// FPS is the frame rate of the sequence.
+	FPS float32
+	// ResizeToDisplay is passed to every handler, see NewCVVDPHandler.
+	ResizeToDisplay bool
+	// MaxHandlers limits the number of CVVDP handlers alive at once, one
+	// per variant. Zero allows one per variant, subject to available VRAM.
+	// When fewer handlers are available than variants, the sequence is read
+	// in several passes and both sources must implement
+	// RewindableFrameSource.
+	MaxHandlers int
+}
+
+// SweepRange returns steps values evenly spaced from first to last, both
+// included, for the axes of SweepOptions.
+func SweepRange(first, last float32, steps int) []float32 {
+	if steps <= 1 {
+		return []float32{first}
+	}
+	values := make([]float32, steps)
+	for i := range values {
+		values[i] = first + (last-first)*float32(i)/float32(steps-1)
+	}
+	return values
+}
+
+// axes returns the axes of the sweep with empty ones replaced by the value
+// of base.
+func (opts SweepOptions) axes(base DisplayModel) (distances, sizes,
+	luminances []float32, ambient []int) {
+	orBase := func(values []float32, v float32) []float32 {
+		if len(values) == 0 {
+			return []float32{v}
+		}
+		return values
+	}
+	distances = orBase(opts.ViewingDistances, base.ViewingDistanceMeters)
+	sizes = orBase(opts.DiagonalSizes, base.DisplayDiagonalSizeInches)
+	luminances = orBase(opts.PeakLuminances, base.DisplayMaxLuminance)
+	ambient = opts.AmbientLevels
+	if len(ambient) == 0 {
+		ambient = []int{base.AmbientLightLevel}
+	}
+	return
+}
+
+// Variants returns the display models of the sweep in the order of
+// SweepResult.Points: viewing distance varies slowest and ambient light
+// fastest. Variant i has the key "sweep-<i>".
+func (opts SweepOptions) Variants(base DisplayModel) []DisplayModel {
+	distances, sizes, luminances, ambient := opts.axes(base)
+	var variants []DisplayModel
+	for _, d := range distances {
+		for _, s := range sizes {
+			for _, l := range luminances {
+				for _, a := range ambient {
+					m := base
+					m.Key = fmt.Sprintf("sweep-%d", len(variants))
+					m.ViewingDistanceMeters = d
+					m.DisplayDiagonalSizeInches = s
+					m.DisplayMaxLuminance = l
+					m.AmbientLightLevel = a
+					variants = append(variants, m)
+				}
+			}
+		}
+	}
+	return variants
+}
+
+// SweepPoint is the score of one variant of a sweep.
+type SweepPoint struct {
+	Model DisplayModel
+	// JOD of the whole sequence under Model.
+	JOD float64
+}
+
+// SweepResult is the grid of scores of a sweep.
+type SweepResult struct {
+	// Axes of the grid, with empty axes of the options filled in from the
+	// base model.
+	ViewingDistances, DiagonalSizes, PeakLuminances []float32
+	AmbientLevels                                   []int
+	// Points holds one score per variant in the order of
+	// SweepOptions.Variants.
+	Points []SweepPoint
+}
+
+// At returns the point at the given index of each axis.
+func (r *SweepResult) At(distance, size, luminance, ambient int) SweepPoint {
+	i := ((distance*len(r.DiagonalSizes)+size)*len(r.PeakLuminances)+
+		luminance)*len(r.AmbientLevels) + ambient
+	return r.Points[i]
+}
+
+// SweepCVVDP scores a sequence under variants of a display model, to see how
+// the perceived quality of an encode depends on screen size, distance,
+// brightness and surroundings.
+//
+// Every frame is read once per pass and submitted to the handlers of all
+// variants concurrently, all of which share one CVVDPDisplayConfig. Handlers
+// are created until opts.MaxHandlers is reached or the device runs out of
+// memory; the remaining variants are scored in further passes.
+func SweepCVVDP(base DisplayModel, ref, dist FrameSource,
+	opts SweepOptions) (*SweepResult, error) {
+	if opts.FPS <= 0 {
+		return nil, errors.New("sweep frame rate must be positive")
+	}
+	variants := opts.Variants(base)
+	config, err := NewCVVDPDisplayConfig(variants...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &SweepResult{Points: make([]SweepPoint, len(variants))}
+	r.ViewingDistances, r.DiagonalSizes, r.PeakLuminances, r.AmbientLevels =
+		opts.axes(base)
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	refFrame, distFrame := NewFrame(&refCS), NewFrame(&distCS)
+
+	for first := 0; first < len(variants); {
+		if first > 0 {
+			if err := rewind(ref, dist); err != nil {
+				return nil, err
+			}
+		}
+		handlers, err := sweepHandlers(config, variants[first:], &refCS,
+			&distCS, opts)
+		if err != nil {
+			return nil, err
+		}
+		scores, err := sweepPass(handlers, ref, dist, refFrame, distFrame)
+		for _, h := range handlers {
+			h.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for i, jod := range scores {
+			r.Points[first+i] = SweepPoint{variants[first+i], jod}
+		}
+		first += len(handlers)
+	}
+	return r, nil
+}
+
+// sweepHandlers creates handlers for as many of variants as opts and the
+// available memory allow, at least one.
+func sweepHandlers(config *CVVDPDisplayConfig, variants []DisplayModel,
+	refCS, distCS *Colorspace, opts SweepOptions) ([]*CVVDPHandler, error) {
+	wanted := len(variants)
+	if opts.MaxHandlers > 0 {
+		wanted = min(wanted, opts.MaxHandlers)
+	}
+
+	var handlers []*CVVDPHandler
+	for _, m := range variants[:wanted] {
+		h, code := config.NewHandler(refCS, distCS, opts.FPS,
+			opts.ResizeToDisplay, m.Key)
+		if len(handlers) > 0 && (code == ExceptionCodeOutOfVRAM ||
+			code == ExceptionCodeOutOfRAM) {
+			break
+		}
+		if !code.IsNone() {
+			for _, h := range handlers {
+				h.Close()
+			}
+			return nil, code.Err()
+		}
+		handlers = append(handlers, h)
+	}
+	return handlers, nil
+}
+
+// sweepPass feeds the whole sequence to every handler and returns their
+// final scores.
+func sweepPass(handlers []*CVVDPHandler, ref, dist FrameSource, refFrame,
+	distFrame *Frame) ([]float64, error) {
+	scores := make([]float64, len(handlers))
+	codes := make([]ExceptionCode, len(handlers))
+	f := 0
+	for ; ; f++ {
+		ok, err := readPair(ref, dist, refFrame, distFrame, f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		var wg sync.WaitGroup
+		for i, h := range handlers {
+			wg.Go(func() {
+				scores[i], codes[i] = h.ComputeScore(nil, 0, refFrame.Planes,
+					distFrame.Planes, refFrame.LineSize, distFrame.LineSize)
+			})
+		}
+		wg.Wait()
+		for _, code := range codes {
+			if !code.IsNone() {
+				return nil, fmt.Errorf("frame %d: %w", f, code.Err())
+			}
+		}
+	}
+	if f == 0 {
+		return nil, errors.New("no frames to score")
+	}
+	return scores, nil
+}
@@ -0,0 +1,59 @@
+package govship_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_SweepOptions_Variants(t *testing.T) {
+	base := vship.DisplayModelPresetStandardFHD
+	opts := vship.SweepOptions{
+		ViewingDistances: vship.SweepRange(0.5, 1.5, 3),
+		AmbientLevels:    []int{0, 250},
+	}
+	if d := opts.ViewingDistances; !slices.Equal(d, []float32{0.5, 1, 1.5}) {
+		t.Fatalf("range = %v", d)
+	}
+
+	variants := opts.Variants(base)
+	if len(variants) != 6 {
+		t.Fatalf("got %d variants, want 6", len(variants))
+	}
+	// Ambient light varies fastest.
+	v := variants[3]
+	if v.Key != "sweep-3" || v.ViewingDistanceMeters != 1 ||
+		v.AmbientLightLevel != 250 ||
+		v.DisplayDiagonalSizeInches != base.DisplayDiagonalSizeInches ||
+		v.DisplayMaxLuminance != base.DisplayMaxLuminance {
+		t.Fatalf("unexpected variant %+v", v)
+	}
+}
+
+func Test_SweepCVVDP(t *testing.T) {
+	ref := grayFrames(256, 256, make([]byte, 12)...)
+	dist := grayFrames(256, 256, bytes.Repeat([]byte{8}, 12)...)
+
+	result, err := vship.SweepCVVDP(vship.DisplayModelPresetStandardFHD, ref,
+		dist, vship.SweepOptions{
+			ViewingDistances: []float32{0.3, 1.2},
+			PeakLuminances:   []float32{100, 400},
+			FPS:              24,
+			MaxHandlers:      3,
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Points) != 4 {
+		t.Fatalf("got %d points, want 4", len(result.Points))
+	}
+	// Differences are harder to see from further away.
+	if near, far := result.At(0, 0, 0, 0), result.At(1, 0, 0,
+		0); far.JOD < near.JOD {
+		t.Fatalf("JOD %v at %vm and %v at %vm", near.JOD,
+			near.Model.ViewingDistanceMeters, far.JOD,
+			far.Model.ViewingDistanceMeters)
+	}
+}
@@ -0,0 +1,294 @@
+package govship
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Metric identifies one of the metrics implemented by Vship.
+type Metric int
+
+const (
+	MetricSSIMU2 Metric = iota
+	MetricButteraugli
+	MetricCVVDP
+)
+
+// String returns the usual name of the metric.
+func (m Metric) String() string {
+	switch m {
+	case MetricSSIMU2:
+		return "SSIMU2"
+	case MetricButteraugli:
+		return "Butteraugli"
+	case MetricCVVDP:
+		return "CVVDP"
+	}
+	return fmt.Sprintf("Metric(%d)", int(m))
+}
+
+// HandlerSpec describes a handler before it is created, with every parameter
+// that affects its memory use.
+type HandlerSpec struct {
+	Metric            Metric
+	Source, Distorted Colorspace
+	// Device is the GPU the handler runs on. It is selected with SetDevice
+	// around every call made through the spec, device 0 included once any
+	// other device has been used.
+	Device int
+	// Butteraugli only, as in NewButteraugliHandler. A DisplayBrightness of
+	// zero is derived from Source with ButteraugliIntensityTarget.
+	Qnorm             int
+	DisplayBrightness float32
+	// CVVDP only. FPS sets the length of the temporal filter.
+	FPS             float32
+	ResizeToDisplay bool
+	// CVVDP only. The display resolution used when ResizeToDisplay is set.
+	// If zero it is taken from ModelKey and ConfigJSON as the handler would.
+	// When neither defines a resolution, estimates assume the larger of the
+	// source and a 4K display, so unknown models are not underestimated.
+	DisplayWidth, DisplayHeight int
+	ModelKey, ConfigJSON        string
+}
+
+// processingSize returns the resolution the metric works at.
+func (s *HandlerSpec) processingSize() (width, height int) {
+	if s.Metric != MetricCVVDP || !s.ResizeToDisplay {
+		return s.Source.outputSize()
+	}
+	if s.DisplayWidth > 0 && s.DisplayHeight > 0 {
+		return s.DisplayWidth, s.DisplayHeight
+	}
+	if width, height := cvvdpMapSize(&s.Source, true, s.ModelKey,
+		s.ConfigJSON); width > 0 && height > 0 {
+		return width, height
+	}
+	width, height = s.Source.outputSize()
+	return max(width, 3840), max(height, 2160)
+}
+
+// VRAMModel predicts the device memory of handlers from their processing
+// resolution. The memory of a handler is modelled as a fixed overhead plus a
+// cost per processed pixel, plus the upload buffers of both input frames.
+//
+// The default coefficients are deliberately conservative approximations of
+// the allocations made by Vship. They can be calibrated for a specific
+// device and library version by measuring handlers of two sizes.
+type VRAMModel struct {
+	// Fixed memory of a handler in bytes, independent of resolution.
+	Overhead uint64
+	// Bytes per processed pixel for each metric.
+	SSIMU2BytesPerPixel      float64
+	ButteraugliBytesPerPixel float64
+	CVVDPBytesPerPixel       float64
+	// Additional bytes per processed pixel for each frame kept in CVVDP's
+	// temporal filter, whose length is a quarter of a second of frames.
+	CVVDPBytesPerPixelPerFrame float64
+}
+
+// DefaultVRAMModel is the VRAMModel used when none is given.
+var DefaultVRAMModel = VRAMModel{
+	Overhead:                   64 << 20,
+	SSIMU2BytesPerPixel:        160,
+	ButteraugliBytesPerPixel:   220,
+	CVVDPBytesPerPixel:         120,
+	CVVDPBytesPerPixelPerFrame: 24,
+}
+
+// Estimate returns the predicted device memory of a handler in bytes.
+func (m VRAMModel) Estimate(spec HandlerSpec) uint64 {
+	width, height := spec.processingSize()
+	pixels := float64(width) * float64(height)
+
+	var perPixel float64
+	switch spec.Metric {
+	case MetricSSIMU2:
+		perPixel = m.SSIMU2BytesPerPixel
+	case MetricButteraugli:
+		perPixel = m.ButteraugliBytesPerPixel
+	case MetricCVVDP:
+		frames := max(math.Ceil(float64(spec.FPS)/4), 1)
+		perPixel = m.CVVDPBytesPerPixel +
+			frames*m.CVVDPBytesPerPixelPerFrame
+	}
+
+	var input uint64
+	for _, cs := range []*Colorspace{&spec.Source, &spec.Distorted} {
+		for i := range 3 {
+			w, h := cs.planeSize(i)
+			input += uint64(w * h * cs.bytesPerSample())
+		}
+	}
+	return m.Overhead + uint64(math.Ceil(pixels*perPixel)) + input
+}
+
+// EstimateVRAM returns the device memory a handler is predicted to need,
+// according to DefaultVRAMModel.
+func EstimateVRAM(spec HandlerSpec) uint64 {
+	return DefaultVRAMModel.Estimate(spec)
+}
+
+// VRAMSchedulerOptions configures a VRAMScheduler.
+type VRAMSchedulerOptions struct {
+	// Budget is the device memory in bytes that handlers may use. If zero,
+	// it is the VRAMSize of the device times Headroom.
+	Budget uint64
+	// Headroom is the fraction of the device memory given to handlers,
+	// leaving the rest for the driver and other processes. Defaults to 0.9.
+	Headroom float64
+	// Model predicts the memory of handlers. Defaults to DefaultVRAMModel.
+	Model *VRAMModel
+}
+
+// VRAMScheduler admits handlers on a device only while their predicted
+// memory fits the budget of the device.
+//
+// Work is reserved before a handler is created and the reservation is
+// released once the handler is closed. TryReserve refuses work that does not
+// fit right now, while Reserve queues it until enough memory is released.
+// Queued reservations are granted in order, so large handlers are not starved
+// by smaller ones. A VRAMScheduler is safe for concurrent use.
+type VRAMScheduler struct {
+	model  VRAMModel
+	budget uint64
+
+	mu      sync.Mutex
+	used    uint64
+	waiters []*vramWaiter
+}
+
+// VRAMReservation is memory reserved on a VRAMScheduler.
+type VRAMReservation struct {
+	scheduler *VRAMScheduler
+	bytes     uint64
+	once      sync.Once
+}
+
+type vramWaiter struct {
+	bytes uint64
+	ready chan struct{}
+}
+
+// NewVRAMScheduler creates a VRAMScheduler for the device gpuID. The device
+// is only queried when opts.Budget is zero.
+func NewVRAMScheduler(gpuID int, opts VRAMSchedulerOptions) (*VRAMScheduler,
+	ExceptionCode) {
+	if opts.Budget == 0 {
+		info, code := GetDeviceInfo(gpuID)
+		if !code.IsNone() {
+			return nil, code
+		}
+		if opts.Headroom <= 0 || opts.Headroom > 1 {
+			opts.Headroom = 0.9
+		}
+		opts.Budget = uint64(float64(info.VRAMSize) * opts.Headroom)
+	}
+	s := &VRAMScheduler{model: DefaultVRAMModel, budget: opts.Budget}
+	if opts.Model != nil {
+		s.model = *opts.Model
+	}
+	return s, ExceptionCodeNoError
+}
+
+// Estimate returns the memory the scheduler would reserve for spec.
+func (s *VRAMScheduler) Estimate(spec HandlerSpec) uint64 {
+	return s.model.Estimate(spec)
+}
+
+// Budget returns the memory available to handlers in total.
+func (s *VRAMScheduler) Budget() uint64 { return s.budget }
+
+// Used returns the memory currently reserved.
+func (s *VRAMScheduler) Used() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// TryReserve reserves the memory of a handler if it fits the budget now. It
+// returns false without waiting otherwise.
+func (s *VRAMScheduler) TryReserve(spec HandlerSpec) (*VRAMReservation,
+	bool) {
+	bytes := s.model.Estimate(spec)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiters) > 0 || s.used+bytes > s.budget {
+		return nil, false
+	}
+	s.used += bytes
+	return &VRAMReservation{scheduler: s, bytes: bytes}, true
+}
+
+// Reserve reserves the memory of a handler, waiting for other reservations
+// to be released if needed. It fails immediately with an *Exception carrying
+// ExceptionCodeOutOfVRAM if the handler can never fit the budget, and with
+// the context error if ctx is done first.
+func (s *VRAMScheduler) Reserve(ctx context.Context,
+	spec HandlerSpec) (*VRAMReservation, error) {
+	bytes := s.model.Estimate(spec)
+	if bytes > s.budget {
+		return nil, fmt.Errorf("%v handler needs about %d MiB, budget is "+
+			"%d MiB: %w", spec.Metric, bytes>>20, s.budget>>20,
+			ExceptionCodeOutOfVRAM.Err())
+	}
+
+	s.mu.Lock()
+	if len(s.waiters) == 0 && s.used+bytes <= s.budget {
+		s.used += bytes
+		s.mu.Unlock()
+		return &VRAMReservation{scheduler: s, bytes: bytes}, nil
+	}
+	w := &vramWaiter{bytes: bytes, ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return &VRAMReservation{scheduler: s, bytes: bytes}, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted concurrently with the cancellation; give it back.
+			s.used -= bytes
+		default:
+			for i, other := range s.waiters {
+				if other == w {
+					s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		s.grant()
+		return nil, ctx.Err()
+	}
+}
+
+// grant admits queued reservations in order while they fit. s.mu must be
+// held.
+func (s *VRAMScheduler) grant() {
+	for len(s.waiters) > 0 && s.used+s.waiters[0].bytes <= s.budget {
+		w := s.waiters[0]
+		s.waiters = s.waiters[1:]
+		s.used += w.bytes
+		close(w.ready)
+	}
+}
+
+// Bytes returns the reserved memory.
+func (r *VRAMReservation) Bytes() uint64 { return r.bytes }
+
+// Release returns the reserved memory to the scheduler. Calling Release more
+// than once has no effect.
+func (r *VRAMReservation) Release() {
+	r.once.Do(func() {
+		s := r.scheduler
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.used -= r.bytes
+		s.grant()
+	})
+}
@@ -0,0 +1,121 @@
+package govship_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func cvvdpSpec(width, height int64) vship.HandlerSpec {
+	spec := vship.HandlerSpec{Metric: vship.MetricCVVDP, FPS: 24,
+		ModelKey: "standard_4k"}
+	spec.Source.SetDefaults(width, height, vship.SamplingFormatUInt10)
+	spec.Distorted = spec.Source
+	return spec
+}
+
+func Test_EstimateVRAM(t *testing.T) {
+	uhd := vship.EstimateVRAM(cvvdpSpec(3840, 2160))
+	eightK := vship.EstimateVRAM(cvvdpSpec(7680, 4320))
+	if eightK < 3*uhd || eightK > 4*uhd {
+		t.Fatalf("8K estimate %d should be about 4x the 4K one %d", eightK,
+			uhd)
+	}
+
+	// Resizing to the display makes the estimate independent of the source
+	// resolution, apart from the upload buffers.
+	small, large := cvvdpSpec(1280, 720), cvvdpSpec(7680, 4320)
+	small.ResizeToDisplay, large.ResizeToDisplay = true, true
+	if d := vship.EstimateVRAM(large) - vship.EstimateVRAM(small); d >
+		200<<20 {
+		t.Fatalf("resized estimates differ by %d bytes", d)
+	}
+	small.DisplayWidth, small.DisplayHeight = 1920, 1080
+	if vship.EstimateVRAM(small) >= vship.EstimateVRAM(large) {
+		t.Fatal("a smaller display should need less memory")
+	}
+
+	// A display model of unknown resolution is not estimated below a 4K
+	// display.
+	known, unknown := cvvdpSpec(1280, 720), cvvdpSpec(1280, 720)
+	known.ResizeToDisplay, unknown.ResizeToDisplay = true, true
+	unknown.ModelKey = "no_such_model"
+	if vship.EstimateVRAM(unknown) < vship.EstimateVRAM(known) {
+		t.Fatal("an unknown display model should not be underestimated")
+	}
+
+	fast := cvvdpSpec(3840, 2160)
+	fast.FPS = 120
+	if vship.EstimateVRAM(fast) <= uhd {
+		t.Fatal("a longer temporal filter should need more memory")
+	}
+}
+
+func Test_VRAMScheduler(t *testing.T) {
+	spec := vship.HandlerSpec{Metric: vship.MetricSSIMU2}
+	spec.Source.SetDefaults(1920, 1080, vship.SamplingFormatUInt8)
+	spec.Distorted = spec.Source
+	need := vship.EstimateVRAM(spec)
+
+	s, code := vship.NewVRAMScheduler(0, vship.VRAMSchedulerOptions{
+		Budget: need*2 + need/2})
+	if !code.IsNone() {
+		t.Fatal(code.GetError())
+	}
+
+	a, ok := s.TryReserve(spec)
+	if !ok {
+		t.Fatal("first reservation should fit")
+	}
+	b, err := s.Reserve(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.TryReserve(spec); ok {
+		t.Fatal("third reservation should be refused")
+	}
+
+	granted := make(chan *vship.VRAMReservation)
+	go func() {
+		r, err := s.Reserve(context.Background(), spec)
+		if err != nil {
+			t.Error(err)
+		}
+		granted <- r
+	}()
+	select {
+	case <-granted:
+		t.Fatal("reservation should wait for memory")
+	case <-time.After(20 * time.Millisecond):
+	}
+	a.Release()
+	a.Release()
+	c := <-granted
+	if s.Used() != 2*need {
+		t.Fatalf("Used() = %d, want %d", s.Used(), 2*need)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Reserve(ctx, spec); !errors.Is(err,
+		context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+
+	huge := cvvdpSpec(7680, 4320)
+	var exc *vship.Exception
+	if _, err := s.Reserve(context.Background(), huge); !errors.As(err,
+		&exc) || exc.Code != vship.ExceptionCodeOutOfVRAM {
+		t.Fatalf("err = %v, want OutOfVRAM", err)
+	}
+
+	b.Release()
+	c.Release()
+	if s.Used() != 0 {
+		t.Fatalf("Used() = %d after releasing everything", s.Used())
+	}
+}
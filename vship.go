@@ -18,6 +18,17 @@ const (
 	BackendCuda Backend = 1
 )
 
+// String returns the name of the backend.
+func (b Backend) String() string {
+	switch b {
+	case BackendHIP:
+		return "HIP"
+	case BackendCuda:
+		return "CUDA"
+	}
+	return fmt.Sprintf("Backend(%d)", int(b))
+}
+
 // Version contains Vship library version info.
 type Version struct {
 	Major, Minor, MinorMinor int
@@ -43,6 +54,9 @@ func FullGpuCheck(gpuId int) ExceptionCode {
 }
 
 func SetDevice(gpuId int) ExceptionCode {
+	if gpuId != 0 {
+		deviceChanged.Store(true)
+	}
 	return ExceptionCode(C.Vship_SetDevice(C.int(gpuId)))
 }
 
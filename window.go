@@ -0,0 +1,198 @@
+package govship
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+// WindowOptions configures ScoreWindowsCVVDP. All lengths are in frames; use
+// the frame rate of the handler to convert from seconds.
+type WindowOptions struct {
+	// Length is the number of scored frames in each window.
+	Length int
+	// Hop is the distance between the first frames of two consecutive
+	// windows. A Hop smaller than Length produces overlapping windows.
+	Hop int
+	// WarmUp is the number of frames before each window that are fed to the
+	// temporal filter with LoadTemporal. Windows near the start of the
+	// sequence get as many warm-up frames as are available.
+	WarmUp int
+	// MaxHandlers limits the number of CVVDP handlers alive at once,
+	// including the handler passed in. Zero allows as many as the window
+	// layout needs, subject to available VRAM. When fewer handlers are
+	// available than windows overlap, the sequence is read in several
+	// passes and both sources must implement RewindableFrameSource.
+	MaxHandlers int
+}
+
+// WindowScore is the CVVDP score of one window of a sequence.
+type WindowScore struct {
+	// Frames [Start, End) scored in the window.
+	Start, End int
+	// StartSeconds is the presentation time of the first scored frame.
+	StartSeconds float64
+	// JOD score of the window.
+	Score float64
+}
+
+// windowPlan describes how windows are distributed over handlers. Windows
+// k with k % passes == p are scored in pass p, on lane (k / passes) % lanes.
+type windowPlan struct {
+	opts          WindowOptions
+	passes, lanes int
+}
+
+func newWindowPlan(opts WindowOptions, handlers int) windowPlan {
+	span := opts.WarmUp + opts.Length
+	plan := windowPlan{opts: opts, passes: 1}
+	for {
+		stride := plan.passes * opts.Hop
+		plan.lanes = (span + stride - 1) / stride
+		if plan.lanes <= handlers {
+			return plan
+		}
+		plan.passes++
+	}
+}
+
+func (p windowPlan) start(k int) int { return k * p.opts.Hop }
+func (p windowPlan) end(k int) int   { return p.start(k) + p.opts.Length }
+
+func (p windowPlan) warmStart(k int) int {
+	return max(0, p.start(k)-p.opts.WarmUp)
+}
+
+// active returns the windows of a pass that need frame f, in order.
+func (p windowPlan) active(pass, f int) []int {
+	var windows []int
+	first := 0
+	if f >= p.opts.Length {
+		first = (f-p.opts.Length)/p.opts.Hop + 1
+	}
+	first += (pass - first%p.passes + p.passes) % p.passes
+	last := (f + p.opts.WarmUp) / p.opts.Hop
+	for k := first; k <= last; k += p.passes {
+		if p.warmStart(k) <= f && f < p.end(k) {
+			windows = append(windows, k)
+		}
+	}
+	return windows
+}
+
+// lane returns the handler lane a window is scored on.
+func (p windowPlan) lane(k int) int { return (k / p.passes) % p.lanes }
+
+// ScoreWindowsCVVDP scores a sequence in fixed-length, possibly overlapping
+// windows and returns one JOD score per window, in order.
+//
+// Before each window the handler is Reset and the preceding opts.WarmUp
+// frames are loaded with LoadTemporal, so every window is judged with the
+// temporal adaptation a viewer would have, as when a clip is cut from a
+// longer sequence. Windows that are not complete at the end of the sequence
+// are not reported.
+//
+// Overlapping windows are scored on separate handlers in flight at the same
+// time. h is used as the first handler and further handlers with identical
+// configuration are created as needed, until opts.MaxHandlers is reached or
+// the device runs out of memory. Frames are submitted to all handlers
+// concurrently. The additional handlers are closed before returning.
+func ScoreWindowsCVVDP(h *CVVDPHandler, ref, dist FrameSource,
+	opts WindowOptions) ([]WindowScore, error) {
+	if opts.Length <= 0 || opts.Hop <= 0 || opts.WarmUp < 0 {
+		return nil, errors.New("window length and hop must be positive " +
+			"and warm-up must not be negative")
+	}
+
+	span := opts.WarmUp + opts.Length
+	wanted := (span + opts.Hop - 1) / opts.Hop
+	if opts.MaxHandlers > 0 {
+		wanted = min(wanted, opts.MaxHandlers)
+	}
+
+	handlers := []*CVVDPHandler{h}
+	defer func() {
+		for _, extra := range handlers[1:] {
+			extra.Close()
+		}
+	}()
+	for len(handlers) < wanted {
+		extra, code := h.clone()
+		if code == ExceptionCodeOutOfVRAM || code == ExceptionCodeOutOfRAM {
+			break
+		}
+		if !code.IsNone() {
+			return nil, code.Err()
+		}
+		handlers = append(handlers, extra)
+	}
+
+	plan := newWindowPlan(opts, len(handlers))
+	refCS, distCS := ref.Colorspace(), dist.Colorspace()
+	refFrame, distFrame := NewFrame(&refCS), NewFrame(&distCS)
+
+	var results []WindowScore
+	for pass := range plan.passes {
+		if pass > 0 {
+			if err := rewind(ref, dist); err != nil {
+				return nil, err
+			}
+		}
+
+		for f := 0; ; f++ {
+			ok, err := readPair(ref, dist, refFrame, distFrame, f)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+
+			windows := plan.active(pass, f)
+			scores := make([]float64, len(windows))
+			codes := make([]ExceptionCode, len(windows))
+			var wg sync.WaitGroup
+			for i, k := range windows {
+				wg.Go(func() {
+					scores[i], codes[i] = submitWindowFrame(
+						handlers[plan.lane(k)], plan, k, f, refFrame,
+						distFrame)
+				})
+			}
+			wg.Wait()
+
+			for i, k := range windows {
+				if !codes[i].IsNone() {
+					return nil, codes[i].Err()
+				}
+				if f == plan.end(k)-1 {
+					results = append(results, WindowScore{plan.start(k),
+						plan.end(k), float64(plan.start(k)) / float64(h.fps),
+						scores[i]})
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(results, func(a, b WindowScore) int {
+		return a.Start - b.Start
+	})
+	return results, nil
+}
+
+// submitWindowFrame feeds frame f to the handler scoring window k, resetting
+// the handler on the first frame of the window's warm-up.
+func submitWindowFrame(h *CVVDPHandler, plan windowPlan, k, f int, refFrame,
+	distFrame *Frame) (float64, ExceptionCode) {
+	if f == plan.warmStart(k) {
+		if code := h.Reset(); !code.IsNone() {
+			return 0, code
+		}
+	}
+	if f < plan.start(k) {
+		return 0, h.LoadTemporal(refFrame.Planes, distFrame.Planes,
+			refFrame.LineSize, distFrame.LineSize)
+	}
+	return h.ComputeScore(nil, 0, refFrame.Planes, distFrame.Planes,
+		refFrame.LineSize, distFrame.LineSize)
+}
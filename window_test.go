@@ -0,0 +1,38 @@
+package govship_test
+
+import (
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+func Test_ScoreWindowsCVVDP(t *testing.T) {
+	ref := grayFrames(256, 256, make([]byte, 40)...)
+	dist := grayFrames(256, 256, make([]byte, 40)...)
+	cs := ref.Colorspace()
+
+	handler, exception := vship.NewCVVDPHandler(&cs, &cs, 24, false,
+		"standard_fhd")
+	if !exception.IsNone() {
+		t.Log(exception.GetError())
+		t.FailNow()
+	}
+	defer handler.Close()
+
+	windows, err := vship.ScoreWindowsCVVDP(handler, ref, dist,
+		vship.WindowOptions{Length: 12, Hop: 6, WarmUp: 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Windows start every 6 frames and need 12 frames: 0, 6, ..., 24.
+	if len(windows) != 5 {
+		t.Fatalf("got %d windows, want 5", len(windows))
+	}
+	for i, w := range windows {
+		if w.Start != i*6 || w.End != i*6+12 {
+			t.Fatalf("window %d covers [%d, %d)", i, w.Start, w.End)
+		}
+		t.Logf("window %d at %.2fs: %.4f JOD", i, w.StartSeconds, w.Score)
+	}
+}
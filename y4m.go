@@ -0,0 +1,264 @@
+package govship
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// y4mSignature starts every YUV4MPEG2 stream.
+const y4mSignature = "YUV4MPEG2"
+
+// Y4MReader is a FrameSource reading a YUV4MPEG2 (.y4m) stream, the raw
+// format produced by ffmpeg, vspipe and most encoders' tooling.
+//
+// The Colorspace is derived from the stream header: size, bit depth, chroma
+// subsampling and chroma location from the C tag and the range from
+// ffmpeg's XCOLORRANGE extension. Y4M does not carry the matrix, transfer or
+// primaries, which default to BT.709 as with Colorspace.SetDefaults and can
+// be corrected with SetColorspace. Monochrome and alpha streams are not
+// supported.
+type Y4MReader struct {
+	src       io.Reader
+	r         *bufio.Reader
+	seeker    io.Seeker // nil if the underlying reader cannot seek
+	dataStart int64
+	cs        Colorspace
+
+	fpsNum, fpsDen int
+	frameSize      int64
+}
+
+// NewY4MReader reads the stream header from r. If r also implements
+// io.Seeker the reader can be rewound and frames are skipped by seeking.
+func NewY4MReader(r io.Reader) (*Y4MReader, error) {
+	y := &Y4MReader{src: r, r: bufio.NewReaderSize(r, 1<<20)}
+	if seeker, ok := r.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			y.seeker = seeker
+			y.dataStart = start
+		}
+	}
+
+	line, err := y.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading y4m header: %w", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != y4mSignature {
+		return nil, errors.New("not a y4m stream")
+	}
+	if err := y.parseHeader(fields[1:]); err != nil {
+		return nil, err
+	}
+	y.dataStart += int64(len(line))
+	return y, nil
+}
+
+// parseHeader fills the Colorspace and frame rate from the header tags.
+func (y *Y4MReader) parseHeader(tags []string) error {
+	var width, height int64
+	chroma, fullRange := "420jpeg", false
+	y.fpsNum, y.fpsDen = 25, 1
+
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		value := tag[1:]
+		var err error
+		switch tag[0] {
+		case 'W':
+			width, err = strconv.ParseInt(value, 10, 64)
+		case 'H':
+			height, err = strconv.ParseInt(value, 10, 64)
+		case 'F':
+			num, den, ok := strings.Cut(value, ":")
+			if y.fpsNum, err = strconv.Atoi(num); err == nil && ok {
+				y.fpsDen, err = strconv.Atoi(den)
+			}
+		case 'C':
+			chroma = value
+		case 'I':
+			if value != "p" && value != "?" {
+				return fmt.Errorf("interlaced y4m (I%s) is not supported",
+					value)
+			}
+		case 'X':
+			if key, v, ok := strings.Cut(value, "="); ok &&
+				key == "COLORRANGE" {
+				fullRange = strings.EqualFold(v, "FULL")
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid y4m header tag %q", tag)
+		}
+	}
+	if width <= 0 || height <= 0 {
+		return errors.New("y4m header lacks a valid frame size")
+	}
+	if y.fpsNum <= 0 || y.fpsDen <= 0 {
+		return errors.New("y4m header has an invalid frame rate")
+	}
+
+	format, subW, subH, location, err := parseY4MChroma(chroma)
+	if err != nil {
+		return err
+	}
+	y.cs.SetDefaults(width, height, format)
+	y.cs.ChromaSubsamplingWidth, y.cs.ChromaSubsamplingHeight = subW, subH
+	y.cs.ChromaLocation = location
+	if fullRange {
+		y.cs.ColorRange = ColorRangeFull
+	}
+	for i := range 3 {
+		w, h := y.cs.planeSize(i)
+		y.frameSize += int64(w * h * y.cs.bytesPerSample())
+	}
+	return nil
+}
+
+// parseY4MChroma decodes the C tag of a y4m header.
+func parseY4MChroma(chroma string) (SamplingFormat, int, int,
+	ChromaLocation, error) {
+	// The 8-bit 4:2:0 variants differ in chroma siting, 420jpeg being the
+	// default of the format.
+	switch chroma {
+	case "420jpeg", "420":
+		return SamplingFormatUInt8, 1, 1, ChromaLocationCenter, nil
+	case "420mpeg2":
+		return SamplingFormatUInt8, 1, 1, ChromaLocationLeft, nil
+	case "420paldv":
+		return SamplingFormatUInt8, 1, 1, ChromaLocationTopLeft, nil
+	}
+
+	unsupported := fmt.Errorf("unsupported y4m colorspace C%s", chroma)
+	layout, depth, _ := strings.Cut(chroma, "p")
+	formats := map[string]SamplingFormat{"": SamplingFormatUInt8,
+		"9": SamplingFormatUInt9, "10": SamplingFormatUInt10,
+		"12": SamplingFormatUInt12, "14": SamplingFormatUInt14,
+		"16": SamplingFormatUInt16}
+	format, ok := formats[depth]
+	if !ok {
+		return 0, 0, 0, 0, unsupported
+	}
+	switch layout {
+	case "420":
+		return format, 1, 1, ChromaLocationLeft, nil
+	case "422":
+		return format, 1, 0, ChromaLocationLeft, nil
+	case "444":
+		return format, 0, 0, ChromaLocationLeft, nil
+	}
+	return 0, 0, 0, 0, unsupported
+}
+
+// Colorspace returns the format of the frames of the stream.
+func (y *Y4MReader) Colorspace() Colorspace { return y.cs }
+
+// SetColorspace replaces the Colorspace reported for the stream, for
+// instance to set the matrix, transfer and primaries that y4m does not
+// carry, or a crop. The size, sampling format and subsampling must stay
+// those of the stream.
+func (y *Y4MReader) SetColorspace(cs Colorspace) error {
+	if cs.Width != y.cs.Width || cs.Height != y.cs.Height ||
+		cs.SamplingFormat != y.cs.SamplingFormat ||
+		cs.ChromaSubsamplingWidth != y.cs.ChromaSubsamplingWidth ||
+		cs.ChromaSubsamplingHeight != y.cs.ChromaSubsamplingHeight ||
+		cs.ColorFamily != y.cs.ColorFamily {
+		return errors.New("colorspace does not match the y4m frame layout")
+	}
+	y.cs = cs
+	return nil
+}
+
+// FrameRate returns the frame rate of the stream as a fraction.
+func (y *Y4MReader) FrameRate() (num, den int) { return y.fpsNum, y.fpsDen }
+
+// FPS returns the frame rate of the stream in frames per second.
+func (y *Y4MReader) FPS() float32 {
+	return float32(y.fpsNum) / float32(y.fpsDen)
+}
+
+// readFrameHeader consumes the FRAME line preceding every frame.
+func (y *Y4MReader) readFrameHeader() error {
+	line, err := y.r.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF && len(line) == 0 {
+			return io.EOF
+		}
+		return fmt.Errorf("reading y4m frame header: %w", err)
+	}
+	if !bytes.HasPrefix(line, []byte("FRAME")) {
+		return errors.New("invalid y4m frame header")
+	}
+	return nil
+}
+
+// ReadFrame reads the next frame into frame with packed rows.
+func (y *Y4MReader) ReadFrame(frame *Frame) error {
+	if err := y.readFrameHeader(); err != nil {
+		return err
+	}
+	bps := y.cs.bytesPerSample()
+	for i := range 3 {
+		w, h := y.cs.planeSize(i)
+		size := w * h * bps
+		if len(frame.Planes[i]) < size {
+			frame.Planes[i] = make([]byte, size)
+		}
+		frame.LineSize[i] = int64(w * bps)
+		if _, err := io.ReadFull(y.r, frame.Planes[i][:size]); err != nil {
+			return fmt.Errorf("reading y4m frame: %w",
+				noUnexpectedEOF(err))
+		}
+	}
+	return nil
+}
+
+// SkipFrame skips the next frame without decoding it. It seeks over the
+// frame data when the underlying reader can seek.
+func (y *Y4MReader) SkipFrame() error {
+	if err := y.readFrameHeader(); err != nil {
+		return err
+	}
+	if y.seeker != nil && int64(y.r.Buffered()) < y.frameSize {
+		offset := y.frameSize - int64(y.r.Buffered())
+		if _, err := y.seeker.Seek(offset, io.SeekCurrent); err != nil {
+			return err
+		}
+		y.r.Reset(y.src)
+		return nil
+	}
+	if _, err := y.r.Discard(int(y.frameSize)); err != nil {
+		return fmt.Errorf("skipping y4m frame: %w", noUnexpectedEOF(err))
+	}
+	return nil
+}
+
+// Rewind restarts the stream at its first frame. It fails if the underlying
+// reader cannot seek.
+func (y *Y4MReader) Rewind() error {
+	if y.seeker == nil {
+		return errors.New("y4m stream cannot be rewound")
+	}
+	if _, err := y.seeker.Seek(y.dataStart, io.SeekStart); err != nil {
+		return err
+	}
+	y.r.Reset(y.src)
+	return nil
+}
+
+// noUnexpectedEOF reports a truncated frame as io.ErrUnexpectedEOF rather
+// than a clean end of stream.
+func noUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+package govship_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	vship "github.com/GreatValueCreamSoda/govship"
+)
+
+// y4mStream builds a 4x2 8-bit 4:2:0 y4m stream where every sample of frame
+// i is i.
+func y4mStream(header string, frames int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header + "\n")
+	for i := range frames {
+		buf.WriteString("FRAME\n")
+		buf.Write(bytes.Repeat([]byte{byte(i)}, 4*2+2*2))
+	}
+	return buf.Bytes()
+}
+
+func Test_Y4MReader(t *testing.T) {
+	data := y4mStream("YUV4MPEG2 W4 H2 F24000:1001 Ip A1:1 C420mpeg2 "+
+		"XCOLORRANGE=FULL", 5)
+	y, err := vship.NewY4MReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := y.Colorspace()
+	if cs.Width != 4 || cs.Height != 2 ||
+		cs.SamplingFormat != vship.SamplingFormatUInt8 ||
+		cs.ColorRange != vship.ColorRangeFull ||
+		cs.ChromaLocation != vship.ChromaLocationLeft {
+		t.Fatalf("unexpected colorspace %+v", cs)
+	}
+	if num, den := y.FrameRate(); num != 24000 || den != 1001 {
+		t.Fatalf("frame rate = %d/%d", num, den)
+	}
+
+	var frame vship.Frame
+	if err := y.SkipFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if err := y.ReadFrame(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Planes[0][0] != 1 || frame.Planes[2][0] != 1 ||
+		frame.LineSize != [3]int64{4, 2, 2} {
+		t.Fatalf("second frame = %v, %v", frame.Planes, frame.LineSize)
+	}
+
+	count := 2
+	for ; ; count++ {
+		if err := y.ReadFrame(&frame); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count != 5 {
+		t.Fatalf("read %d frames, want 5", count)
+	}
+
+	if err := y.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	if err := y.ReadFrame(&frame); err != nil || frame.Planes[0][0] != 0 {
+		t.Fatalf("first frame after rewind = %v, %v", frame.Planes[0], err)
+	}
+}
+
+func Test_Y4MReader_Formats(t *testing.T) {
+	for _, tc := range []struct {
+		tag    string
+		format vship.SamplingFormat
+		subW   int
+		subH   int
+	}{
+		{"C420jpeg", vship.SamplingFormatUInt8, 1, 1},
+		{"C422p10", vship.SamplingFormatUInt10, 1, 0},
+		{"C444p12", vship.SamplingFormatUInt12, 0, 0},
+		{"C420p16", vship.SamplingFormatUInt16, 1, 1},
+	} {
+		y, err := vship.NewY4MReader(bytes.NewReader([]byte(
+			fmt.Sprintf("YUV4MPEG2 W8 H8 F25:1 %s\n", tc.tag))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs := y.Colorspace()
+		if cs.SamplingFormat != tc.format ||
+			cs.ChromaSubsamplingWidth != tc.subW ||
+			cs.ChromaSubsamplingHeight != tc.subH {
+			t.Fatalf("%s: got %+v", tc.tag, cs)
+		}
+	}
+
+	for _, header := range []string{"YUV4MPEG2 W8 H8 Cmono",
+		"YUV4MPEG2 W8 H8 It", "YUV4MPEG2 H8", "P5 8 8"} {
+		if _, err := vship.NewY4MReader(bytes.NewReader([]byte(
+			header + "\n"))); err == nil {
+			t.Fatalf("%q should be rejected", header)
+		}
+	}
+}
+
+func Test_Y4MReader_Truncated(t *testing.T) {
+	data := y4mStream("YUV4MPEG2 W4 H2 F25:1", 2)
+	// Hide Seek so the stream is read sequentially.
+	y, err := vship.NewY4MReader(io.MultiReader(bytes.NewReader(
+		data[:len(data)-3])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frame vship.Frame
+	if err := y.ReadFrame(&frame); err != nil {
+		t.Fatal(err)
+	}
+	if err := y.ReadFrame(&frame); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("err = %v, want unexpected EOF", err)
+	}
+	if err := y.Rewind(); err == nil {
+		t.Fatal("a sequential stream should not rewind")
+	}
+}